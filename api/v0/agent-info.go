@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/cache"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+)
+
+type AgentMinerInfoRes struct {
+	Miner                address.Address `json:"miner"`
+	Balance              string          `json:"balance"`
+	ExpectedDailyRewards string          `json:"expectedDailyRewards"`
+}
+
+type AgentInfoRes struct {
+	ID                   uint64               `json:"id"`
+	Address              ethcommon.Address    `json:"address"`
+	Miners               []*AgentMinerInfoRes `json:"miners"`
+	MinerBalance         string               `json:"minerBalance"`
+	LiquidAssets         string               `json:"liquidAssets"`
+	Principal            string               `json:"principal"`
+	AgentValue           string               `json:"agentValue"`
+	ExpectedDailyRewards string               `json:"expectedDailyRewards"`
+	BorrowCap            string               `json:"borrowCap"`
+	RemainingCapacity    string               `json:"remainingCapacity"`
+	Rate                 string               `json:"rate"`
+	AnnualFeeRate        string               `json:"annualFeeRate"`
+	Denom                string               `json:"denom"`
+	BlockNumber          uint64               `json:"blockNumber"`
+	TipSetKey            types.TipSetKey      `json:"tipSetKey"`
+	Timestamp            uint64               `json:"timestamp"`
+}
+
+func AgentInfo(w http.ResponseWriter, r *http.Request) {
+	sdk, err := shared.NewSDK(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var shouldConvert bool = false
+	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
+		shouldConvert = true
+	}
+
+	// an agent ID or 0x address
+	agentRef := strings.ToLower(r.URL.Query().Get("agent"))
+	if agentRef == "" {
+		http.Error(w, "Error: agent is required", http.StatusBadRequest)
+		return
+	}
+
+	blockNumber, err := common.GetBlockNumberQP(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting block number: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	agents, err := shared.GetAgentLister(chainID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting agent list: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// an agent's ID and address never change once deployed, so resolved agents never expire
+	agentKey := cache.Key{ChainID: chainID.Int64(), Endpoint: "agent", Params: agentRef}
+	resolved, err := cache.Default.GetOrComputeFinal(agentKey, func() (interface{}, error) {
+		return m.ResolveAgent(r.Context(), agents, agentRef)
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving agent: %v", err), agentErrorStatus(err))
+		return
+	}
+	agent := resolved.(*m.Agent)
+
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	q, closeRates, err := shared.ConnectPoolRates(sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to the pool's rate module: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closeRates()
+
+	head, ts, err := shared.ResolveTipSets(r.Context(), lapi, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "agent-info", Params: fmt.Sprint(agent.ID)}
+	cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+		return m.AgentInfo(r.Context(), q, lapi, m.NewMinerStats(lapi), agent, big.NewInt(int64(ts.Height())))
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting agent info: %v", err), agentErrorStatus(err))
+		return
+	}
+	data := cached.(*m.AgentInfoData)
+
+	fmtVal := func(val *big.Int) string { return val.String() }
+	res := &AgentInfoRes{
+		ID:            data.ID,
+		Address:       data.Address,
+		Miners:        make([]*AgentMinerInfoRes, len(data.Miners)),
+		Rate:          data.Rate.String(),
+		AnnualFeeRate: fmt.Sprintf("%0.03f%%", common.AnnualizeRate(data.Rate)),
+		Denom:         "attofil",
+		BlockNumber:   data.Height.Uint64(),
+		TipSetKey:     data.TipSetKey,
+		Timestamp:     data.Timestamp,
+	}
+	if shouldConvert {
+		fmtVal = common.FmtFILVal
+		res.Denom = "fil"
+	}
+	res.MinerBalance = fmtVal(data.MinerBalance)
+	res.LiquidAssets = fmtVal(data.LiquidAssets)
+	res.Principal = fmtVal(data.Principal)
+	res.AgentValue = fmtVal(data.AgentValue)
+	res.ExpectedDailyRewards = fmtVal(data.EDR)
+	res.BorrowCap = fmtVal(data.MaxBorrow)
+	res.RemainingCapacity = fmtVal(data.RemainingCapacity)
+
+	for i, miner := range data.Miners {
+		res.Miners[i] = &AgentMinerInfoRes{
+			Miner:                miner.Miner,
+			Balance:              fmtVal(miner.Balance),
+			ExpectedDailyRewards: fmtVal(miner.EDR),
+		}
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding agent info to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// agentErrorStatus maps agent resolution errors to client errors, anything else failed on our side
+func agentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, m.ErrInvalidAgent):
+		return http.StatusBadRequest
+	case errors.Is(err, m.ErrAgentNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	m "github.com/glifio/pools-metrics/metrics"
+)
+
+func TestAgentErrorStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w ID %q", m.ErrInvalidAgent, "abc"), http.StatusBadRequest},
+		{fmt.Errorf("%w: %s", m.ErrAgentNotFound, "42"), http.StatusNotFound},
+		{errors.New("failed to list agents: connection refused"), http.StatusInternalServerError},
+	} {
+		if got := agentErrorStatus(tc.err); got != tc.want {
+			t.Fatalf("agentErrorStatus(%v): got %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/cache"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+)
+
+type AgentRes struct {
+	ID           uint64            `json:"id"`
+	Address      ethcommon.Address `json:"address"`
+	Miners       []address.Address `json:"miners"`
+	MinerBalance string            `json:"minerBalance"`
+	LiquidAssets string            `json:"liquidAssets"`
+	Principal    string            `json:"principal"`
+	QAP          string            `json:"qap"`
+	RBP          string            `json:"rbp"`
+	Equity       string            `json:"equity"`
+}
+
+type AgentsRes struct {
+	Agents      []*AgentRes     `json:"agents"`
+	Count       uint64          `json:"count"`
+	Denom       string          `json:"denom"`
+	BlockNumber uint64          `json:"blockNumber"`
+	TipSetKey   types.TipSetKey `json:"tipSetKey"`
+	Timestamp   uint64          `json:"timestamp"`
+}
+
+func Agents(w http.ResponseWriter, r *http.Request) {
+	sdk, err := shared.NewSDK(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var shouldConvert bool = false
+	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
+		shouldConvert = true
+	}
+
+	blockNumber, err := common.GetBlockNumberQP(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting block number: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lister, err := shared.GetAgentLister(chainID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting agent list: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	head, ts, err := shared.ResolveTipSets(r.Context(), lapi, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "agents"}
+	cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+		return m.Agents(r.Context(), sdk.Query(), lapi, lister, big.NewInt(key.Height))
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting agents: %v", err), http.StatusInternalServerError)
+		return
+	}
+	agents := cached.([]*m.AgentBreakdown)
+
+	fmtVal := func(val *big.Int) string { return val.String() }
+	res := &AgentsRes{
+		Agents:      make([]*AgentRes, len(agents)),
+		Count:       uint64(len(agents)),
+		Denom:       "attofil",
+		BlockNumber: uint64(ts.Height()),
+		TipSetKey:   ts.Key(),
+		Timestamp:   ts.MinTimestamp(),
+	}
+	if shouldConvert {
+		fmtVal = common.FmtFILVal
+		res.Denom = "fil"
+	}
+
+	for i, agent := range agents {
+		res.Agents[i] = &AgentRes{
+			ID:           agent.ID,
+			Address:      agent.Address,
+			Miners:       agent.Miners,
+			MinerBalance: fmtVal(agent.MinerBalance),
+			LiquidAssets: fmtVal(agent.LiquidAssets),
+			Principal:    fmtVal(agent.Principal),
+			QAP:          agent.QAP.String(),
+			RBP:          agent.RBP.String(),
+			Equity:       fmtVal(agent.Equity),
+		}
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding agents to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
@@ -6,16 +6,25 @@ import (
 	"math/big"
 	"net/http"
 
+	"github.com/glifio/pools-metrics/cache"
 	"github.com/glifio/pools-metrics/common"
 	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
 )
 
 type ApyRes struct {
-	Apy *big.Float `json:"apy"`
+	Apy      *big.Float        `json:"apy"`
+	Realized []*RealizedApyRes `json:"realized,omitempty"`
+}
+
+type RealizedApyRes struct {
+	Days        int64      `json:"days"`
+	BlockNumber uint64     `json:"blockNumber"`
+	Apy         *big.Float `json:"apy"`
 }
 
 func Apy(w http.ResponseWriter, r *http.Request) {
-	sdk, err := common.NewSDK(r)
+	sdk, err := shared.NewSDK(r)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
 		return
@@ -27,20 +36,69 @@ func Apy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	apy, err := m.Apy(r.Context(), sdk, blockNumber)
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	head, ts, err := shared.ResolveTipSets(r.Context(), lapi, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "apy"}
+	cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+		return m.Apy(r.Context(), sdk.Query(), big.NewInt(key.Height))
+	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error getting apy: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	apy.Mul(apy, big.NewFloat(100))
+	realizedKey := cache.Key{ChainID: chainID.Int64(), Height: key.Height, Endpoint: "apy-realized"}
+	realized, err := cache.Default.GetOrCompute(realizedKey, int64(head.Height()), func() (interface{}, error) {
+		return m.RealizedApys(r.Context(), sdk.Query(), lapi, big.NewInt(key.Height))
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting realized apy: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	res := EncodeApy(cached.(*big.Float), realized.([]*m.RealizedApy))
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(&ApyRes{
-		Apy: apy,
-	}); err != nil {
+	if err := json.NewEncoder(w).Encode(res); err != nil {
 		http.Error(w, fmt.Sprintf("Error encoding apy to JSON: %v", err), http.StatusInternalServerError)
 		return
 	}
 }
+
+// EncodeApy converts the projected and realized apys to percentages, without modifying them
+func EncodeApy(projected *big.Float, realized []*m.RealizedApy) *ApyRes {
+	res := &ApyRes{
+		Apy:      new(big.Float).Mul(projected, big.NewFloat(100)),
+		Realized: make([]*RealizedApyRes, len(realized)),
+	}
+
+	for i, apy := range realized {
+		res.Realized[i] = &RealizedApyRes{
+			Days:        apy.Days,
+			BlockNumber: apy.Height.Uint64(),
+		}
+		if apy.Apy != nil {
+			res.Realized[i].Apy = new(big.Float).Mul(apy.Apy, big.NewFloat(100))
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+)
+
+// term quoted when none is requested
+const defaultBorrowTermDays = 365
+
+type BorrowQuoteRes struct {
+	Miner             address.Address `json:"miner"`
+	AgentID           uint64          `json:"agentId"`
+	Amount            string          `json:"amount"`
+	TermDays          int64           `json:"termDays"`
+	Rate              string          `json:"rate"`
+	AnnualFeeRate     string          `json:"annualFeeRate"`
+	DailyInterest     string          `json:"dailyInterest"`
+	TotalInterest     string          `json:"totalInterest"`
+	MaxBorrow         string          `json:"maxBorrow"`
+	RemainingCapacity string          `json:"remainingCapacity"`
+	ExceedsMaxBorrow  bool            `json:"exceedsMaxBorrow"`
+	Principal         string          `json:"principal"`
+	Collateral        string          `json:"collateral"`
+	Equity            string          `json:"equity"`
+	LTV               string          `json:"ltv"`
+	DTE               string          `json:"dte"`
+	Denom             string          `json:"denom"`
+	BlockNumber       uint64          `json:"blockNumber"`
+	TipSetKey         types.TipSetKey `json:"tipSetKey"`
+	Timestamp         uint64          `json:"timestamp"`
+}
+
+func BorrowQuote(w http.ResponseWriter, r *http.Request) {
+	sdk, err := shared.NewSDK(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var shouldConvert bool = false
+	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
+		shouldConvert = true
+	}
+
+	minerAddr, err := address.NewFromString(r.URL.Query().Get("miner"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing miner address: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// the amount is in the requested denomination
+	amount, err := parseAmount(r.URL.Query().Get("amount"), shouldConvert)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing amount: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var termDays int64 = defaultBorrowTermDays
+	if term := r.URL.Query().Get("term"); term != "" {
+		termDays, err = strconv.ParseInt(term, 10, 64)
+		if err != nil || termDays <= 0 {
+			http.Error(w, fmt.Sprintf("Error parsing term: %q is not a positive number of days", term), http.StatusBadRequest)
+			return
+		}
+	}
+
+	blockNumber, err := common.GetBlockNumberQP(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting block number: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	agents, err := shared.GetAgentLister(chainID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting agent list: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	q, closeRates, err := shared.ConnectPoolRates(sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to the pool's rate module: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closeRates()
+
+	quote, err := m.BorrowQuote(r.Context(), q, lapi, m.NewMinerStats(lapi), agents, minerAddr, amount, termDays, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting borrow quote: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	fmtVal := func(val *big.Int) string { return val.String() }
+	res := &BorrowQuoteRes{
+		Miner:            quote.Miner,
+		AgentID:          quote.AgentID,
+		TermDays:         quote.TermDays,
+		Rate:             quote.Rate.String(),
+		AnnualFeeRate:    fmt.Sprintf("%0.03f%%", common.AnnualizeRate(quote.Rate)),
+		ExceedsMaxBorrow: quote.ExceedsMaxBorrow,
+		LTV:              common.FmtRatio(quote.LTV),
+		DTE:              common.FmtRatio(quote.DTE),
+		Denom:            "attofil",
+		BlockNumber:      quote.Height.Uint64(),
+		TipSetKey:        quote.TipSetKey,
+		Timestamp:        quote.Timestamp,
+	}
+	if shouldConvert {
+		fmtVal = common.FmtFILVal
+		res.Denom = "fil"
+	}
+	res.Amount = fmtVal(quote.Amount)
+	res.DailyInterest = fmtVal(quote.DailyInterest)
+	res.TotalInterest = fmtVal(quote.TotalInterest)
+	res.MaxBorrow = fmtVal(quote.MaxBorrow)
+	res.RemainingCapacity = fmtVal(quote.RemainingCapacity)
+	res.Principal = fmtVal(quote.Principal)
+	res.Collateral = fmtVal(quote.Collateral)
+	res.Equity = fmtVal(quote.Equity)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding borrow quote to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseAmount parses a positive attoFIL amount, or a FIL amount when inFIL is set
+func parseAmount(amount string, inFIL bool) (*big.Int, error) {
+	if amount == "" {
+		return nil, fmt.Errorf("no amount requested")
+	}
+
+	var val *big.Int
+	if inFIL {
+		fil, err := types.ParseFIL(amount)
+		if err != nil {
+			return nil, err
+		}
+		val = fil.Int
+	} else {
+		var ok bool
+		val, ok = new(big.Int).SetString(amount, 10)
+		if !ok {
+			return nil, fmt.Errorf("%q is not an attoFIL amount", amount)
+		}
+	}
+
+	if val.Sign() <= 0 {
+		return nil, fmt.Errorf("amount must be positive, got %s", amount)
+	}
+
+	return val, nil
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/cache"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+)
+
+type ConcentrationRes struct {
+	HHI   string `json:"hhi"`
+	Top1  string `json:"top1"`
+	Top5  string `json:"top5"`
+	Top10 string `json:"top10"`
+}
+
+type ConcentrationsRes struct {
+	AgentPrincipal  *ConcentrationRes `json:"agentPrincipal"`
+	AgentCollateral *ConcentrationRes `json:"agentCollateral"`
+	AgentQAP        *ConcentrationRes `json:"agentQap"`
+	MinerCollateral *ConcentrationRes `json:"minerCollateral"`
+	MinerQAP        *ConcentrationRes `json:"minerQap"`
+	BlockNumber     uint64            `json:"blockNumber"`
+	TipSetKey       types.TipSetKey   `json:"tipSetKey"`
+	Timestamp       uint64            `json:"timestamp"`
+}
+
+func Concentration(w http.ResponseWriter, r *http.Request) {
+	sdk, err := shared.NewSDK(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	blockNumber, err := common.GetBlockNumberQP(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting block number: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	agents, err := shared.GetAgentLister(chainID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting agent list: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	head, ts, err := shared.ResolveTipSets(r.Context(), lapi, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "concentration"}
+	cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+		return m.Concentrations(r.Context(), sdk.Query(), lapi, agents, big.NewInt(key.Height))
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting concentration: %v", err), http.StatusInternalServerError)
+		return
+	}
+	data := cached.(*m.ConcentrationData)
+
+	res := &ConcentrationsRes{
+		AgentPrincipal:  encodeConcentration(data.AgentPrincipal),
+		AgentCollateral: encodeConcentration(data.AgentCollateral),
+		AgentQAP:        encodeConcentration(data.AgentQAP),
+		MinerCollateral: encodeConcentration(data.MinerCollateral),
+		MinerQAP:        encodeConcentration(data.MinerQAP),
+		BlockNumber:     uint64(ts.Height()),
+		TipSetKey:       ts.Key(),
+		Timestamp:       ts.MinTimestamp(),
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding concentration to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func encodeConcentration(c *m.Concentration) *ConcentrationRes {
+	return &ConcentrationRes{
+		HHI:   common.FmtRatio(c.HHI),
+		Top1:  common.FmtRatio(c.Top1),
+		Top5:  common.FmtRatio(c.Top5),
+		Top10: common.FmtRatio(c.Top10),
+	}
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/cache"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+)
+
+type MinerFaultsRes struct {
+	Miner                address.Address `json:"miner"`
+	AgentID              uint64          `json:"agentId"`
+	LiveSectors          uint64          `json:"liveSectors"`
+	FaultySectors        uint64          `json:"faultySectors"`
+	RecoveringSectors    uint64          `json:"recoveringSectors"`
+	FaultyRBP            string          `json:"faultyRBP"`
+	FaultyQAP            string          `json:"faultyQAP"`
+	ExpectedDailyRewards string          `json:"expectedDailyRewards"`
+	DailyFaultPenalty    string          `json:"dailyFaultPenalty"`
+}
+
+type FaultsRes struct {
+	FaultySectors     uint64            `json:"faultySectors"`
+	FaultyRBP         string            `json:"faultyRBP"`
+	FaultyQAP         string            `json:"faultyQAP"`
+	FaultyMiners      uint64            `json:"faultyMiners"`
+	DailyFaultPenalty string            `json:"dailyFaultPenalty"`
+	Miners            []*MinerFaultsRes `json:"miners"`
+	Denom             string            `json:"denom"`
+	BlockNumber       uint64            `json:"blockNumber"`
+	TipSetKey         types.TipSetKey   `json:"tipSetKey"`
+	Timestamp         uint64            `json:"timestamp"`
+}
+
+func Faults(w http.ResponseWriter, r *http.Request) {
+	sdk, err := shared.NewSDK(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var shouldConvert bool = false
+	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
+		shouldConvert = true
+	}
+
+	blockNumber, err := common.GetBlockNumberQP(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting block number: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	head, ts, err := shared.ResolveTipSets(r.Context(), lapi, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "faults"}
+	cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+		return m.Faults(r.Context(), sdk.Query(), lapi, m.NewMinerStats(lapi), big.NewInt(key.Height))
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting faults: %v", err), http.StatusInternalServerError)
+		return
+	}
+	data := cached.(*m.FaultData)
+
+	fmtVal := func(val *big.Int) string { return val.String() }
+	res := &FaultsRes{
+		FaultySectors: data.FaultySectors.Uint64(),
+		FaultyRBP:     data.FaultyRBP.String(),
+		FaultyQAP:     data.FaultyQAP.String(),
+		FaultyMiners:  data.FaultyMiners,
+		Miners:        make([]*MinerFaultsRes, len(data.Miners)),
+		Denom:         "attofil",
+		BlockNumber:   uint64(ts.Height()),
+		TipSetKey:     ts.Key(),
+		Timestamp:     ts.MinTimestamp(),
+	}
+	if shouldConvert {
+		fmtVal = common.FmtFILVal
+		res.Denom = "fil"
+	}
+	res.DailyFaultPenalty = fmtVal(data.DailyFaultPenalty)
+
+	for i, miner := range data.Miners {
+		res.Miners[i] = &MinerFaultsRes{
+			Miner:                miner.Miner,
+			AgentID:              miner.AgentID,
+			LiveSectors:          miner.LiveSectors.Uint64(),
+			FaultySectors:        miner.FaultySectors.Uint64(),
+			RecoveringSectors:    miner.RecoveringSectors.Uint64(),
+			FaultyRBP:            miner.FaultyRBP.String(),
+			FaultyQAP:            miner.FaultyQAP.String(),
+			ExpectedDailyRewards: fmtVal(miner.ExpectedDailyRewards),
+			DailyFaultPenalty:    fmtVal(miner.DailyFaultPenalty),
+		}
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding faults to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
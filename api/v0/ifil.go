@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/cache"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+)
+
+type IFILRateChangeRes struct {
+	Epochs      int64  `json:"epochs"`
+	BlockNumber uint64 `json:"blockNumber"`
+	Rate        string `json:"rate"`
+	Change      string `json:"change"`
+}
+
+type IFILRes struct {
+	TotalSupply string               `json:"totalSupply"`
+	TotalAssets string               `json:"totalAssets"`
+	Rate        string               `json:"rate"`
+	Changes     []*IFILRateChangeRes `json:"changes"`
+	Denom       string               `json:"denom"`
+	BlockNumber uint64               `json:"blockNumber"`
+	TipSetKey   types.TipSetKey      `json:"tipSetKey"`
+	Timestamp   uint64               `json:"timestamp"`
+}
+
+func IFIL(w http.ResponseWriter, r *http.Request) {
+	sdk, err := shared.NewSDK(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var shouldConvert bool = false
+	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
+		shouldConvert = true
+	}
+
+	blockNumber, err := common.GetBlockNumberQP(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting block number: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	head, ts, err := shared.ResolveTipSets(r.Context(), lapi, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "ifil"}
+	cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+		return m.IFIL(r.Context(), sdk.Query(), lapi, big.NewInt(key.Height))
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting iFIL: %v", err), http.StatusInternalServerError)
+		return
+	}
+	data := cached.(*m.IFILData)
+
+	fmtVal := func(val *big.Int) string { return val.String() }
+	res := &IFILRes{
+		Rate:        common.FmtRatio(data.Rate),
+		Changes:     make([]*IFILRateChangeRes, len(data.Changes)),
+		Denom:       "attofil",
+		BlockNumber: uint64(ts.Height()),
+		TipSetKey:   ts.Key(),
+		Timestamp:   ts.MinTimestamp(),
+	}
+	if shouldConvert {
+		fmtVal = common.FmtFILVal
+		res.Denom = "fil"
+	}
+	res.TotalSupply = fmtVal(data.TotalSupply)
+	res.TotalAssets = fmtVal(data.TotalAssets)
+
+	for i, change := range data.Changes {
+		res.Changes[i] = &IFILRateChangeRes{
+			Epochs:      change.Epochs,
+			BlockNumber: change.Height.Uint64(),
+			Rate:        common.FmtRatio(change.Rate),
+			Change:      common.FmtRatio(change.Change),
+		}
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding iFIL to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
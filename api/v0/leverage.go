@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/cache"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+)
+
+type DistributionRes struct {
+	Count  uint64 `json:"count"`
+	Median string `json:"median"`
+	P90    string `json:"p90"`
+	Max    string `json:"max"`
+}
+
+type AgentLeverageRes struct {
+	ID         uint64            `json:"id"`
+	Address    ethcommon.Address `json:"address"`
+	Principal  string            `json:"principal"`
+	Collateral string            `json:"collateral"`
+	Equity     string            `json:"equity"`
+	LTV        string            `json:"ltv"`
+	// omitted when the agent's equity is not positive
+	DTE string `json:"dte,omitempty"`
+}
+
+type LeverageRes struct {
+	Principal       string              `json:"principal"`
+	Collateral      string              `json:"collateral"`
+	Equity          string              `json:"equity"`
+	LTV             string              `json:"ltv"`
+	DTE             string              `json:"dte,omitempty"`
+	AgentLTV        *DistributionRes    `json:"agentLtv"`
+	AgentDTE        *DistributionRes    `json:"agentDte"`
+	InsolventAgents uint64              `json:"insolventAgents"`
+	Agents          []*AgentLeverageRes `json:"agents"`
+	Denom           string              `json:"denom"`
+	BlockNumber     uint64              `json:"blockNumber"`
+	TipSetKey       types.TipSetKey     `json:"tipSetKey"`
+	Timestamp       uint64              `json:"timestamp"`
+}
+
+func Leverage(w http.ResponseWriter, r *http.Request) {
+	sdk, err := shared.NewSDK(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var shouldConvert bool = false
+	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
+		shouldConvert = true
+	}
+
+	blockNumber, err := common.GetBlockNumberQP(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting block number: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	agents, err := shared.GetAgentLister(chainID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting agent list: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	head, ts, err := shared.ResolveTipSets(r.Context(), lapi, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "leverage"}
+	cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+		return m.Leverage(r.Context(), sdk.Query(), lapi, agents, big.NewInt(key.Height))
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting leverage: %v", err), http.StatusInternalServerError)
+		return
+	}
+	leverage := cached.(*m.LeverageData)
+
+	fmtVal := func(val *big.Int) string { return val.String() }
+	denom := "attofil"
+	if shouldConvert {
+		fmtVal = common.FmtFILVal
+		denom = "fil"
+	}
+
+	res := &LeverageRes{
+		Principal:       fmtVal(leverage.Principal),
+		Collateral:      fmtVal(leverage.Collateral),
+		Equity:          fmtVal(leverage.Equity),
+		LTV:             common.FmtRatio(leverage.LTV),
+		DTE:             common.FmtRatio(leverage.DTE),
+		AgentLTV:        encodeDistribution(leverage.AgentLTV),
+		AgentDTE:        encodeDistribution(leverage.AgentDTE),
+		InsolventAgents: leverage.InsolventAgents,
+		Agents:          make([]*AgentLeverageRes, len(leverage.Agents)),
+		Denom:           denom,
+		BlockNumber:     uint64(ts.Height()),
+		TipSetKey:       ts.Key(),
+		Timestamp:       ts.MinTimestamp(),
+	}
+	for i, agent := range leverage.Agents {
+		res.Agents[i] = &AgentLeverageRes{
+			ID:         agent.ID,
+			Address:    agent.Address,
+			Principal:  fmtVal(agent.Principal),
+			Collateral: fmtVal(agent.Collateral),
+			Equity:     fmtVal(agent.Equity),
+			LTV:        common.FmtRatio(agent.LTV),
+			DTE:        common.FmtRatio(agent.DTE),
+		}
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding leverage to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func encodeDistribution(d *m.Distribution) *DistributionRes {
+	return &DistributionRes{
+		Count:  d.Count,
+		Median: common.FmtRatio(d.Median),
+		P90:    common.FmtRatio(d.P90),
+		Max:    common.FmtRatio(d.Max),
+	}
+}
@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/glifio/pools-metrics/cache"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+	"github.com/glifio/pools-metrics/store"
+)
+
+const (
+	// maxHistoryPoints bounds the number of snapshots a single history request can ask for
+	maxHistoryPoints = 1000
+	// maxComputedHistoryPoints bounds the number of missing snapshots a single history request computes,
+	// larger gaps are filled by the worker and the backfill command
+	maxComputedHistoryPoints = 5
+)
+
+type MetricsHistoryRes struct {
+	Points []map[string]interface{} `json:"points"`
+	// heights left out because they are not stored yet and the request computed as many as it may
+	Missing []int64 `json:"missing"`
+	Denom   string  `json:"denom"`
+}
+
+// MetricsHistory returns the metrics at every step between two heights (from, to) or two unix timestamps
+// (fromTimestamp, toTimestamp). Snapshots are read from the store where available, and at most
+// maxComputedHistoryPoints missing ones are computed. The fields param optionally limits each point
+// to a comma separated list of fields.
+func MetricsHistory(w http.ResponseWriter, r *http.Request) {
+	sdk, err := shared.NewSDK(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	agents, err := shared.GetAgentLister(chainID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting agent list: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var shouldConvert bool = false
+	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
+		shouldConvert = true
+	}
+
+	head, latest, err := shared.ResolveTipSets(r.Context(), lapi, nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	genesis, err := m.ResolveTipSet(r.Context(), lapi, big.NewInt(0))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting genesis tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	from, to, step, err := parseHistoryRange(r.URL.Query(), int64(latest.Height()), genesis.MinTimestamp())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing history range: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var fields []string
+	if fieldsStr := r.URL.Query().Get("fields"); fieldsStr != "" {
+		fields = strings.Split(fieldsStr, ",")
+	}
+
+	// index the stored snapshots in the range by height
+	st := store.Default()
+	stored := make(map[int64]*m.MetricData)
+	if st != nil {
+		snapshots, err := st.Range(chainID, from, to)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading snapshot store: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, snapshot := range snapshots {
+			stored[snapshot.Height.Int64()] = snapshot
+		}
+	}
+
+	res := &MetricsHistoryRes{Points: []map[string]interface{}{}, Missing: []int64{}, Denom: "attofil"}
+	if shouldConvert {
+		res.Denom = "fil"
+	}
+	computed := 0
+	for height := from; height <= to; height += step {
+		// null rounds resolve to an earlier tipset, which is the height the snapshot is stored under
+		ts, err := m.ResolveTipSet(r.Context(), lapi, big.NewInt(height))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error resolving tipset at %d: %v", height, err), http.StatusInternalServerError)
+			return
+		}
+
+		metrics, ok := stored[int64(ts.Height())]
+		if !ok {
+			if computed == maxComputedHistoryPoints {
+				res.Missing = append(res.Missing, int64(ts.Height()))
+				continue
+			}
+			computed++
+
+			key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "metrics"}
+			cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+				return m.Metrics(r.Context(), sdk.Query(), lapi, agents, big.NewInt(key.Height))
+			})
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error getting metrics at %d: %v", height, err), http.StatusInternalServerError)
+				return
+			}
+			metrics = cached.(*m.MetricData)
+
+			// tipsets that could still be reorged are only cached
+			if st != nil && int64(head.Height())-metrics.Height.Int64() >= cache.Finality {
+				if err := st.Put(chainID, metrics); err != nil {
+					http.Error(w, fmt.Sprintf("Error saving snapshot at %d: %v", height, err), http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+
+		encoded := encodeHistoryMetrics(metrics, shouldConvert)
+		encoded.EpochsBehindHead = int64(head.Height()) - metrics.Height.Int64()
+
+		point, err := selectFields(encoded, fields)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error selecting fields: %v", err), http.StatusBadRequest)
+			return
+		}
+		res.Points = append(res.Points, point)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding metrics history to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseHistoryRange returns the heights and step of a history request. Heights default to
+// the day before latest, and timestamps are converted to the height of the epoch containing them.
+func parseHistoryRange(qparams url.Values, latest int64, genesisTimestamp uint64) (from int64, to int64, step int64, err error) {
+	parseHeight := func(heightParam string, timestampParam string, def int64) (int64, error) {
+		if s := qparams.Get(heightParam); s != "" {
+			return strconv.ParseInt(s, 10, 64)
+		}
+		if s := qparams.Get(timestampParam); s != "" {
+			timestamp, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			if timestamp < genesisTimestamp {
+				return 0, fmt.Errorf("%s is before genesis", timestampParam)
+			}
+			return int64(timestamp-genesisTimestamp) / builtin.EpochDurationSeconds, nil
+		}
+		return def, nil
+	}
+
+	to, err = parseHeight("to", "toTimestamp", latest)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if to > latest {
+		to = latest
+	}
+
+	from, err = parseHeight("from", "fromTimestamp", to-builtin.EpochsInDay)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if from < 0 {
+		from = 0
+	}
+	if from > to {
+		return 0, 0, 0, errors.New("from must not be after to")
+	}
+
+	step = int64(builtin.EpochsInHour)
+	if s := qparams.Get("step"); s != "" {
+		step, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if step <= 0 {
+			return 0, 0, 0, errors.New("step must be greater than 0")
+		}
+	}
+
+	if (to-from)/step+1 > maxHistoryPoints {
+		return 0, 0, 0, fmt.Errorf("range covers more than %d points, increase step", maxHistoryPoints)
+	}
+
+	return from, to, step, nil
+}
+
+// selectFields returns res as a JSON object holding only fields, plus the block number, timestamp and denom
+func selectFields(res *MetricsHandlerRes, fields []string) (map[string]interface{}, error) {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]interface{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return all, nil
+	}
+
+	point := map[string]interface{}{
+		"blockNumber": all["blockNumber"],
+		"timestamp":   all["timestamp"],
+		"denom":       all["denom"],
+	}
+	for _, field := range fields {
+		val, ok := all[field]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		point[field] = val
+	}
+
+	return point, nil
+}
+
+// this is a duplicate function because vercel doesn't allow for shared code between these route files
+func encodeHistoryMetrics(metrics *m.MetricData, shouldConvert bool) *MetricsHandlerRes {
+	var res *MetricsHandlerRes
+	if !shouldConvert {
+		res = &MetricsHandlerRes{
+			PoolTotalAssets:           metrics.PoolTotalAssets.String(),
+			PoolTotalBorrowed:         metrics.PoolTotalBorrowed.String(),
+			PoolTotalBorrowableAssets: metrics.PoolTotalBorrowableAssets.String(),
+			PoolExitReserve:           metrics.PoolExitReserve.String(),
+			TotalMinerCollaterals:     metrics.TotalMinerCollaterals.String(),
+			TotalValueLocked:          metrics.TotalValueLocked.String(),
+			WithdrawableLiquidity:     metrics.WithdrawableLiquidity.String(),
+			Denom:                     "attofil",
+		}
+	} else {
+		res = &MetricsHandlerRes{
+			PoolTotalAssets:           common.FmtFILVal(metrics.PoolTotalAssets),
+			PoolTotalBorrowed:         common.FmtFILVal(metrics.PoolTotalBorrowed),
+			PoolTotalBorrowableAssets: common.FmtFILVal(metrics.PoolTotalBorrowableAssets),
+			PoolExitReserve:           common.FmtFILVal(metrics.PoolExitReserve),
+			TotalMinerCollaterals:     common.FmtFILVal(metrics.TotalMinerCollaterals),
+			TotalValueLocked:          common.FmtFILVal(metrics.TotalValueLocked),
+			WithdrawableLiquidity:     common.FmtFILVal(metrics.WithdrawableLiquidity),
+			Denom:                     "fil",
+		}
+	}
+
+	res.TotalAgentCount = metrics.TotalAgentCount.Uint64()
+	res.TotalMinersCount = metrics.TotalMinersCount.Uint64()
+	res.TotalMinersSectors = metrics.TotalMinersSectors.String()
+	res.TotalMinerQAP = metrics.TotalMinerQAP.String()
+	res.TotalMinerRBP = metrics.TotalMinerRBP.String()
+	res.TotalActiveSectors = metrics.TotalActiveSectors.String()
+	res.TotalFaultySectors = metrics.TotalFaultySectors.String()
+	res.TotalRecoveringSectors = metrics.TotalRecoveringSectors.String()
+	res.NetworkQAP = metrics.NetworkQAP.String()
+	res.NetworkRBP = metrics.NetworkRBP.String()
+	res.QAPShare = common.FmtRatio(metrics.QAPShare)
+	res.RBPShare = common.FmtRatio(metrics.RBPShare)
+	res.BlockRewardShare = common.FmtRatio(metrics.BlockRewardShare)
+	res.Utilization = common.FmtRatio(metrics.Utilization)
+	res.BorrowableShare = common.FmtRatio(metrics.BorrowableShare)
+	res.ExitReserveCoverage = common.FmtRatio(metrics.ExitReserveCoverage)
+	res.BlockNumber = metrics.Height.Uint64()
+	res.TipSetKey = metrics.TipSetKey
+	res.Timestamp = metrics.Timestamp
+
+	return res
+}
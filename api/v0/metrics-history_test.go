@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseHistoryRange(t *testing.T) {
+	const latest = 10000
+	const genesis = 1000
+
+	for _, tc := range []struct {
+		name           string
+		query          string
+		from, to, step int64
+		wantErr        bool
+	}{
+		{name: "defaults to the last day hourly", query: "", from: latest - 2880, to: latest, step: 120},
+		{name: "heights", query: "from=100&to=200&step=50", from: 100, to: 200, step: 50},
+		{name: "timestamps", query: "fromTimestamp=4000&toTimestamp=7000&step=10", from: 100, to: 200, step: 10},
+		{name: "to is capped at latest", query: "from=9000&to=20000&step=500", from: 9000, to: latest, step: 500},
+		{name: "from is floored at genesis", query: "to=100&step=50", from: 0, to: 100, step: 50},
+		{name: "from after to", query: "from=300&to=200", wantErr: true},
+		{name: "zero step", query: "step=0", wantErr: true},
+		{name: "invalid height", query: "from=abc", wantErr: true},
+		{name: "timestamp before genesis", query: "fromTimestamp=10", wantErr: true},
+		{name: "too many points", query: "from=0&to=10000&step=1", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			qparams, err := url.ParseQuery(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			from, to, step, err := parseHistoryRange(qparams, latest, genesis)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got from %d to %d step %d", from, to, step)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if from != tc.from || to != tc.to || step != tc.step {
+				t.Fatalf("got from %d to %d step %d, want from %d to %d step %d", from, to, step, tc.from, tc.to, tc.step)
+			}
+		})
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	res := &MetricsHandlerRes{
+		PoolTotalAssets: "100",
+		TotalAgentCount: 3,
+		Denom:           "attofil",
+		BlockNumber:     42,
+		Timestamp:       1000,
+	}
+
+	all, err := selectFields(res, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all["poolTotalAssets"] != "100" || all["totalMinerQAP"] != "" {
+		t.Fatalf("expected every field without a selection, got %v", all)
+	}
+
+	point, err := selectFields(res, []string{"poolTotalAssets", "totalAgentCount"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"poolTotalAssets": "100",
+		"totalAgentCount": float64(3),
+		"blockNumber":     float64(42),
+		"timestamp":       float64(1000),
+		"denom":           "attofil",
+	}
+	if len(point) != len(want) {
+		t.Fatalf("got fields %v, want %v", point, want)
+	}
+	for field, val := range want {
+		if point[field] != val {
+			t.Fatalf("%s: got %v, want %v", field, point[field], val)
+		}
+	}
+
+	if _, err := selectFields(res, []string{"notAField"}); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
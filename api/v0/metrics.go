@@ -3,11 +3,16 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/http"
 	"strings"
 
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/cache"
 	"github.com/glifio/pools-metrics/common"
 	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+	"github.com/glifio/pools-metrics/worker"
 )
 
 type MetricsHandlerRes struct {
@@ -22,18 +27,41 @@ type MetricsHandlerRes struct {
 	TotalMinerQAP             string `json:"totalMinerQAP"`
 	TotalMinerRBP             string `json:"totalMinerRBP"`
 	TotalValueLocked          string `json:"totalValueLocked"`
+	TotalActiveSectors        string `json:"totalActiveSectors"`
+	TotalFaultySectors        string `json:"totalFaultySectors"`
+	TotalRecoveringSectors    string `json:"totalRecoveringSectors"`
+	NetworkQAP                string `json:"networkQAP"`
+	NetworkRBP                string `json:"networkRBP"`
+	QAPShare                  string `json:"qapShare"`
+	RBPShare                  string `json:"rbpShare"`
+	BlockRewardShare          string `json:"blockRewardShare"`
+	Utilization               string `json:"utilization"`
+	BorrowableShare           string `json:"borrowableShare"`
+	ExitReserveCoverage       string `json:"exitReserveCoverage"`
+	WithdrawableLiquidity     string `json:"withdrawableLiquidity"`
 
-	Denom       string `json:"denom"`
-	BlockNumber uint64 `json:"blockNumber"`
+	Denom       string          `json:"denom"`
+	BlockNumber uint64          `json:"blockNumber"`
+	TipSetKey   types.TipSetKey `json:"tipSetKey"`
+	Timestamp   uint64          `json:"timestamp"`
+	// how many epochs the chain head is ahead of the metrics' tipset
+	EpochsBehindHead int64 `json:"epochsBehindHead"`
 }
 
 func Metrics(w http.ResponseWriter, r *http.Request) {
-	sdk, err := common.NewSDK(r)
+	sdk, err := shared.NewSDK(r)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
 		return
 	}
 
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
 	var shouldConvert bool = false
 	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
 		shouldConvert = true
@@ -45,21 +73,56 @@ func Metrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	metrics, err := m.Metrics(r.Context(), sdk, blockNumber)
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	agents, err := shared.GetAgentLister(chainID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting agent list: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	head, err := lapi.ChainHead(r.Context())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting metrics: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error getting chain head: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// serve the latest precomputed snapshot when a background worker is running
+	metrics, ok := worker.Latest(chainID)
+	if blockNumber != nil || !ok {
+		ts, err := m.ResolveTipSet(r.Context(), lapi, blockNumber)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "metrics"}
+		cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+			return m.Metrics(r.Context(), sdk.Query(), lapi, agents, big.NewInt(key.Height))
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error getting metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		metrics = cached.(*m.MetricData)
+	}
+
+	res := EncodeMetrics(metrics, shouldConvert)
+	res.EpochsBehindHead = int64(head.Height()) - metrics.Height.Int64()
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	if err := json.NewEncoder(w).Encode(encodeMetrics(metrics, shouldConvert)); err != nil {
+	if err := json.NewEncoder(w).Encode(res); err != nil {
 		http.Error(w, fmt.Sprintf("Error encoding metrics to JSON: %v", err), http.StatusInternalServerError)
 		return
 	}
 }
 
-func encodeMetrics(metrics *m.MetricData, shouldConvert bool) *MetricsHandlerRes {
+func EncodeMetrics(metrics *m.MetricData, shouldConvert bool) *MetricsHandlerRes {
 	var res *MetricsHandlerRes
 	if !shouldConvert {
 		res = &MetricsHandlerRes{
@@ -69,6 +132,7 @@ func encodeMetrics(metrics *m.MetricData, shouldConvert bool) *MetricsHandlerRes
 			PoolExitReserve:           metrics.PoolExitReserve.String(),
 			TotalMinerCollaterals:     metrics.TotalMinerCollaterals.String(),
 			TotalValueLocked:          metrics.TotalValueLocked.String(),
+			WithdrawableLiquidity:     metrics.WithdrawableLiquidity.String(),
 			Denom:                     "attofil",
 		}
 	} else {
@@ -79,12 +143,30 @@ func encodeMetrics(metrics *m.MetricData, shouldConvert bool) *MetricsHandlerRes
 			PoolExitReserve:           common.FmtFILVal(metrics.PoolExitReserve),
 			TotalMinerCollaterals:     common.FmtFILVal(metrics.TotalMinerCollaterals),
 			TotalValueLocked:          common.FmtFILVal(metrics.TotalValueLocked),
+			WithdrawableLiquidity:     common.FmtFILVal(metrics.WithdrawableLiquidity),
 			Denom:                     "fil",
 		}
 	}
 
 	res.TotalAgentCount = metrics.TotalAgentCount.Uint64()
 	res.TotalMinersCount = metrics.TotalMinersCount.Uint64()
+	res.TotalMinersSectors = metrics.TotalMinersSectors.String()
+	res.TotalMinerQAP = metrics.TotalMinerQAP.String()
+	res.TotalMinerRBP = metrics.TotalMinerRBP.String()
+	res.TotalActiveSectors = metrics.TotalActiveSectors.String()
+	res.TotalFaultySectors = metrics.TotalFaultySectors.String()
+	res.TotalRecoveringSectors = metrics.TotalRecoveringSectors.String()
+	res.NetworkQAP = metrics.NetworkQAP.String()
+	res.NetworkRBP = metrics.NetworkRBP.String()
+	res.QAPShare = common.FmtRatio(metrics.QAPShare)
+	res.RBPShare = common.FmtRatio(metrics.RBPShare)
+	res.BlockRewardShare = common.FmtRatio(metrics.BlockRewardShare)
+	res.Utilization = common.FmtRatio(metrics.Utilization)
+	res.BorrowableShare = common.FmtRatio(metrics.BorrowableShare)
+	res.ExitReserveCoverage = common.FmtRatio(metrics.ExitReserveCoverage)
+	res.BlockNumber = metrics.Height.Uint64()
+	res.TipSetKey = metrics.TipSetKey
+	res.Timestamp = metrics.Timestamp
 
 	return res
 }
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+)
+
+const (
+	// largest number of miners accepted in a single batch request
+	maxMinerInfoBatch = 100
+	// largest request body accepted, well above maxMinerInfoBatch addresses
+	maxMinerInfoBatchBody = 64 << 10
+	// number of miners computed at once against the shared Lotus connection
+	minerInfoBatchConcurrency = 8
+)
+
+type MinerInfoBatchReq struct {
+	Miners []string `json:"miners"`
+}
+
+// MinerInfoBatchItem is a single miner's info, or the error computing it.
+// Every miner is computed at the batch's tipset, reported once on MinerInfoBatchRes.
+type MinerInfoBatchItem struct {
+	Miner                string `json:"miner"`
+	BorrowStart          string `json:"borrowStart,omitempty"`
+	BorrowCap            string `json:"borrowCap,omitempty"`
+	ExpectedDailyRewards string `json:"expectedDailyRewards,omitempty"`
+	Equity               string `json:"equity,omitempty"`
+	AnnualFeeRate        string `json:"annualFeeRate,omitempty"`
+	Denom                string `json:"denom,omitempty"`
+	Error                string `json:"error,omitempty"`
+}
+
+type MinerInfoBatchRes struct {
+	Miners      []*MinerInfoBatchItem `json:"miners"`
+	BlockNumber uint64                `json:"blockNumber"`
+	TipSetKey   types.TipSetKey       `json:"tipSetKey"`
+	Timestamp   uint64                `json:"timestamp"`
+}
+
+func MinerInfoBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Error: miner-info batch requests must be POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MinerInfoBatchReq
+	r.Body = http.MaxBytesReader(w, r.Body, maxMinerInfoBatchBody)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Error: request body larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Error decoding request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Miners) == 0 {
+		http.Error(w, "Error: no miners requested", http.StatusBadRequest)
+		return
+	}
+	if len(req.Miners) > maxMinerInfoBatch {
+		http.Error(w, fmt.Sprintf("Error: too many miners requested (%d > %d)", len(req.Miners), maxMinerInfoBatch), http.StatusBadRequest)
+		return
+	}
+
+	sdk, err := shared.NewSDK(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var shouldConvert bool = false
+	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
+		shouldConvert = true
+	}
+
+	blockNumber, err := common.GetBlockNumberQP(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting block number: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	q, closeRates, err := shared.ConnectPoolRates(sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to the pool's rate module: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closeRates()
+
+	_, ts, err := shared.ResolveTipSets(r.Context(), lapi, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	res := &MinerInfoBatchRes{
+		Miners:      make([]*MinerInfoBatchItem, len(req.Miners)),
+		BlockNumber: uint64(ts.Height()),
+		TipSetKey:   ts.Key(),
+		Timestamp:   ts.MinTimestamp(),
+	}
+
+	// invalid addresses fail on their own, the rest of the batch is still computed
+	var miners []address.Address
+	var indexes []int
+	for i, miner := range req.Miners {
+		res.Miners[i] = &MinerInfoBatchItem{Miner: miner}
+		addr, err := address.NewFromString(miner)
+		if err != nil {
+			res.Miners[i].Error = fmt.Sprintf("Error parsing miner address: %v", err)
+			continue
+		}
+		miners = append(miners, addr)
+		indexes = append(indexes, i)
+	}
+
+	if len(miners) > 0 {
+		results, err := m.BatchMinerInfo(r.Context(), q, lapi, m.NewMinerStats(lapi), miners, big.NewInt(int64(ts.Height())), minerInfoBatchConcurrency)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error getting miner info: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		for i, result := range results {
+			item := res.Miners[indexes[i]]
+			if result.Err != nil {
+				item.Error = fmt.Sprintf("Error getting miner max borrow: %v", result.Err)
+				continue
+			}
+
+			info := result.Info
+			encodeBatchMinerInfo(item, info.MaxBorrow, info.AgentValue, info.EDR, common.AnnualizeRate(info.Rate), shouldConvert)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding miner info batch to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// this is a duplicate function because vercel doesn't allow for shared code between these route files
+func encodeBatchMinerInfo(item *MinerInfoBatchItem, borrowStart *big.Int, borrowCap *big.Int, edr *big.Int, rate *big.Float, shouldConvert bool) {
+	if !shouldConvert {
+		item.BorrowCap = borrowCap.String()
+		item.BorrowStart = borrowStart.String()
+		item.ExpectedDailyRewards = edr.String()
+		item.Equity = borrowCap.String()
+		item.Denom = "attofil"
+	} else {
+		item.BorrowCap = common.FmtFILVal(borrowCap)
+		item.BorrowStart = common.FmtFILVal(borrowStart)
+		item.ExpectedDailyRewards = common.FmtFILVal(edr)
+		item.Equity = common.FmtFILVal(borrowCap)
+		item.Denom = "fil"
+	}
+
+	item.AnnualFeeRate = fmt.Sprintf("%0.03f%%", rate)
+}
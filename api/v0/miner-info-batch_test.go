@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMinerInfoBatchRejectsLargeBody(t *testing.T) {
+	body := `{"miners":["` + strings.Repeat("f0", maxMinerInfoBatchBody) + `"]}`
+	r := httptest.NewRequest(http.MethodPost, "/miner-info/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	MinerInfoBatch(w, r)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -8,10 +8,11 @@ import (
 	"strings"
 
 	"github.com/filecoin-project/go-address"
-	"github.com/glifio/go-pools/constants"
-	"github.com/glifio/go-pools/util"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/cache"
 	"github.com/glifio/pools-metrics/common"
 	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
 )
 
 type MinerInfoHandler struct {
@@ -21,42 +22,115 @@ type MinerInfoHandler struct {
 	Equity               string `json:"equity"`
 	AnnualFeeRate        string `json:"annualFeeRate"`
 	Denom                string `json:"denom"`
+
+	BlockNumber uint64          `json:"blockNumber"`
+	TipSetKey   types.TipSetKey `json:"tipSetKey"`
+	Timestamp   uint64          `json:"timestamp"`
+	// every intermediate of the computation, only set with explain=true
+	Explain *MinerInfoExplainRes `json:"explain,omitempty"`
+}
+
+type MinerInfoExplainRes struct {
+	LazyExpectedDailyRewards string `json:"lazyExpectedDailyRewards"`
+	VestingFunds             string `json:"vestingFunds"`
+	VestingDays              int64  `json:"vestingDays"`
+	// vestingFunds / vestingDays, added to the lazy expected daily rewards
+	VestingComponent     string `json:"vestingComponent"`
+	ExpectedDailyRewards string `json:"expectedDailyRewards"`
+	// sent to NullishVerifiableCredential to get the rate
+	AgentData *AgentDataRes `json:"agentData"`
+	// per-epoch WAD rate
+	Rate string `json:"rate"`
+	// MaxBorrowFromAgentData(agentData, rate)
+	MaxBorrow string `json:"maxBorrow"`
+}
+
+type AgentDataRes struct {
+	AgentValue                  string `json:"agentValue"`
+	CollateralValue             string `json:"collateralValue"`
+	ExpectedDailyFaultPenalties string `json:"expectedDailyFaultPenalties"`
+	ExpectedDailyRewards        string `json:"expectedDailyRewards"`
+	Gcred                       string `json:"gcred"`
+	QaPower                     string `json:"qaPower"`
+	Principal                   string `json:"principal"`
+	FaultySectors               string `json:"faultySectors"`
+	LiveSectors                 string `json:"liveSectors"`
+	GreenScore                  string `json:"greenScore"`
 }
 
 func MinerInfo(w http.ResponseWriter, r *http.Request) {
-	sdk, err := common.NewSDK(r)
+	sdk, err := shared.NewSDK(r)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
 		return
 	}
 
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	q, closeRates, err := shared.ConnectPoolRates(sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to the pool's rate module: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closeRates()
+
 	minerAddr, err := address.NewFromString(r.URL.Query().Get("miner"))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error parsing miner address: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	borrowStart, borrowCap, edr, rate, err := m.MinerInfo(r.Context(), sdk, minerAddr)
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	blockNumber, err := common.GetBlockNumberQP(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting block number: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	head, ts, err := shared.ResolveTipSets(r.Context(), lapi, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "miner-info", Params: minerAddr.String()}
+	cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+		return m.MinerInfoAt(r.Context(), q, lapi, m.NewMinerStats(lapi), minerAddr, big.NewInt(int64(ts.Height())))
+	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error getting miner max borrow: %v", err), http.StatusInternalServerError)
 		return
 	}
+	info := cached.(*m.MinerInfoData)
 
-	// annualize rate
-	rate.Mul(rate, big.NewInt(constants.EpochsInYear))
-	rate.Div(rate, constants.WAD)
-	filRate := util.ToFIL(rate)
-	// make a rate a percentage
-	filRate.Mul(filRate, big.NewFloat(100))
+	filRate := common.AnnualizeRate(info.Rate)
 
 	var shouldConvert bool = false
 	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
 		shouldConvert = true
 	}
 
+	res := EncodeMinerInfo(info.MaxBorrow, info.AgentValue, info.EDR, filRate, shouldConvert)
+	res.BlockNumber = info.Height.Uint64()
+	res.TipSetKey = info.TipSetKey
+	res.Timestamp = info.Timestamp
+	if r.URL.Query().Get("explain") == "true" {
+		res.Explain = EncodeMinerInfoExplain(info, shouldConvert)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	if err := json.NewEncoder(w).Encode(EncodeMinerInfo(borrowStart, borrowCap, edr, filRate, shouldConvert)); err != nil {
+	if err := json.NewEncoder(w).Encode(res); err != nil {
 		http.Error(w, fmt.Sprintf("Error encoding to JSON: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -86,3 +160,35 @@ func EncodeMinerInfo(borrowStart *big.Int, borrowCap *big.Int, edr *big.Int, rat
 
 	return res
 }
+
+func EncodeMinerInfoExplain(info *m.MinerInfoData, shouldConvert bool) *MinerInfoExplainRes {
+	fmtVal := func(val *big.Int) string { return val.String() }
+	if shouldConvert {
+		fmtVal = common.FmtFILVal
+	}
+
+	inputs := info.Inputs
+	agentData := &AgentDataRes{
+		AgentValue:                  fmtVal(inputs.AgentData.AgentValue),
+		CollateralValue:             fmtVal(inputs.AgentData.CollateralValue),
+		ExpectedDailyFaultPenalties: fmtVal(inputs.AgentData.ExpectedDailyFaultPenalties),
+		ExpectedDailyRewards:        fmtVal(inputs.AgentData.ExpectedDailyRewards),
+		Gcred:                       inputs.AgentData.Gcred.String(),
+		QaPower:                     inputs.AgentData.QaPower.String(),
+		Principal:                   fmtVal(inputs.AgentData.Principal),
+		FaultySectors:               inputs.AgentData.FaultySectors.String(),
+		LiveSectors:                 inputs.AgentData.LiveSectors.String(),
+		GreenScore:                  inputs.AgentData.GreenScore.String(),
+	}
+
+	return &MinerInfoExplainRes{
+		LazyExpectedDailyRewards: fmtVal(inputs.LazyEDR),
+		VestingFunds:             fmtVal(inputs.VestingFunds),
+		VestingDays:              inputs.VestingDays,
+		VestingComponent:         fmtVal(inputs.VestingComponent),
+		ExpectedDailyRewards:     fmtVal(info.EDR),
+		AgentData:                agentData,
+		Rate:                     info.Rate.String(),
+		MaxBorrow:                fmtVal(info.MaxBorrow),
+	}
+}
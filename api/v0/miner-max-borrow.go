@@ -8,46 +8,65 @@ import (
 	"strings"
 
 	"github.com/filecoin-project/go-address"
-	"github.com/glifio/go-pools/constants"
-	"github.com/glifio/go-pools/util"
 	"github.com/glifio/pools-metrics/common"
 	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
 )
 
 func MinerMaxBorrow(w http.ResponseWriter, r *http.Request) {
-	sdk, err := common.NewSDK(r)
+	sdk, err := shared.NewSDK(r)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
 		return
 	}
 
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	q, closeRates, err := shared.ConnectPoolRates(sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to the pool's rate module: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closeRates()
+
 	minerAddr, err := address.NewFromString(r.URL.Query().Get("miner"))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error parsing miner address: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	borrowStart, borrowCap, edr, rate, err := m.MinerInfo(r.Context(), sdk, minerAddr)
+	blockNumber, err := common.GetBlockNumberQP(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting block number: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	info, err := m.MinerInfoAt(r.Context(), q, lapi, m.NewMinerStats(lapi), minerAddr, blockNumber)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error getting miner max borrow: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// annualize rate
-	rate.Mul(rate, big.NewInt(constants.EpochsInYear))
-	rate.Div(rate, constants.WAD)
-	filRate := util.ToFIL(rate)
-	// make a rate a percentage
-	filRate.Mul(filRate, big.NewFloat(100))
+	filRate := common.AnnualizeRate(info.Rate)
 
 	var shouldConvert bool = false
 	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
 		shouldConvert = true
 	}
 
+	res := encodeMinerInfo(info.MaxBorrow, info.AgentValue, info.EDR, filRate, shouldConvert)
+	res.BlockNumber = info.Height.Uint64()
+	res.TipSetKey = info.TipSetKey
+	res.Timestamp = info.Timestamp
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	if err := json.NewEncoder(w).Encode(encodeMinerInfo(borrowStart, borrowCap, edr, filRate, shouldConvert)); err != nil {
+	if err := json.NewEncoder(w).Encode(res); err != nil {
 		http.Error(w, fmt.Sprintf("Error encoding to JSON: %v", err), http.StatusInternalServerError)
 		return
 	}
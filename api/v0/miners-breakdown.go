@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/cache"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+)
+
+type MinerBreakdownRes struct {
+	Miner             address.Address `json:"miner"`
+	AgentID           uint64          `json:"agentId"`
+	Balance           string          `json:"balance"`
+	LockedFunds       string          `json:"lockedFunds"`
+	AvailableFunds    string          `json:"availableFunds"`
+	QAP               string          `json:"qap"`
+	RBP               string          `json:"rbp"`
+	LiveSectors       uint64          `json:"liveSectors"`
+	ActiveSectors     uint64          `json:"activeSectors"`
+	FaultySectors     uint64          `json:"faultySectors"`
+	RecoveringSectors uint64          `json:"recoveringSectors"`
+}
+
+type MinersBreakdownRes struct {
+	Miners      []*MinerBreakdownRes `json:"miners"`
+	Count       uint64               `json:"count"`
+	Denom       string               `json:"denom"`
+	BlockNumber uint64               `json:"blockNumber"`
+	TipSetKey   types.TipSetKey      `json:"tipSetKey"`
+	Timestamp   uint64               `json:"timestamp"`
+}
+
+func MinersBreakdown(w http.ResponseWriter, r *http.Request) {
+	sdk, err := shared.NewSDK(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var shouldConvert bool = false
+	if strings.ToLower(r.URL.Query().Get("denom")) == "fil" {
+		shouldConvert = true
+	}
+
+	blockNumber, err := common.GetBlockNumberQP(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting block number: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	head, ts, err := shared.ResolveTipSets(r.Context(), lapi, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "miners-breakdown"}
+	cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+		return m.MinerBreakdowns(r.Context(), sdk.Query(), lapi, big.NewInt(key.Height))
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting miners: %v", err), http.StatusInternalServerError)
+		return
+	}
+	miners := cached.([]*m.MinerBreakdown)
+
+	fmtVal := func(val *big.Int) string { return val.String() }
+	res := &MinersBreakdownRes{
+		Miners:      make([]*MinerBreakdownRes, len(miners)),
+		Count:       uint64(len(miners)),
+		Denom:       "attofil",
+		BlockNumber: uint64(ts.Height()),
+		TipSetKey:   ts.Key(),
+		Timestamp:   ts.MinTimestamp(),
+	}
+	if shouldConvert {
+		fmtVal = common.FmtFILVal
+		res.Denom = "fil"
+	}
+
+	for i, miner := range miners {
+		res.Miners[i] = &MinerBreakdownRes{
+			Miner:             miner.Miner,
+			AgentID:           miner.AgentID,
+			Balance:           fmtVal(miner.Balance),
+			LockedFunds:       fmtVal(miner.LockedFunds),
+			AvailableFunds:    fmtVal(miner.AvailableFunds),
+			QAP:               miner.QAP.String(),
+			RBP:               miner.RBP.String(),
+			LiveSectors:       miner.LiveSectors.Uint64(),
+			ActiveSectors:     miner.ActiveSectors.Uint64(),
+			FaultySectors:     miner.FaultySectors.Uint64(),
+			RecoveringSectors: miner.RecoveringSectors.Uint64(),
+		}
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding miners to JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
@@ -3,11 +3,14 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/http"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/glifio/pools-metrics/cache"
 	"github.com/glifio/pools-metrics/common"
 	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
 )
 
 type MinersRes struct {
@@ -16,7 +19,7 @@ type MinersRes struct {
 }
 
 func Miners(w http.ResponseWriter, r *http.Request) {
-	sdk, err := common.NewSDK(r)
+	sdk, err := shared.NewSDK(r)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
 		return
@@ -28,7 +31,36 @@ func Miners(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	minerCount, miners, err := m.Miners(r.Context(), sdk, blockNumber)
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	head, ts, err := shared.ResolveTipSets(r.Context(), lapi, blockNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "miners"}
+	cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+		minerCount, miners, err := m.Miners(r.Context(), sdk.Query(), big.NewInt(key.Height))
+		if err != nil {
+			return nil, err
+		}
+		return &MinersRes{
+			Miners: miners,
+			Count:  minerCount.Uint64(),
+		}, nil
+	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error getting miners: %v", err), http.StatusInternalServerError)
 		return
@@ -36,10 +68,7 @@ func Miners(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(&MinersRes{
-		Miners: miners,
-		Count:  minerCount.Uint64(),
-	}); err != nil {
+	if err := json.NewEncoder(w).Encode(cached.(*MinersRes)); err != nil {
 		http.Error(w, fmt.Sprintf("Error encoding metrics to JSON: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/glifio/pools-metrics/cache"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/prom"
+	"github.com/glifio/pools-metrics/shared"
+	"github.com/glifio/pools-metrics/worker"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prom serves the latest metrics and apy as Prometheus gauges, in the text exposition or OpenMetrics format
+func Prom(w http.ResponseWriter, r *http.Request) {
+	sdk, err := shared.NewSDK(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing PoolsSDK: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lapi, closer, err := shared.ConnectLotusClient(r, sdk)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error connecting to Lotus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer closer()
+
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chainID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	agents, err := shared.GetAgentLister(chainID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting agent list: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	head, err := lapi.ChainHead(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting chain head: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// serve the latest precomputed snapshot when a background worker is running
+	metrics, ok := worker.Latest(chainID)
+	if !ok {
+		ts, err := m.ResolveTipSet(r.Context(), lapi, nil)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error resolving tipset: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		key := cache.Key{ChainID: chainID.Int64(), Height: int64(ts.Height()), Endpoint: "metrics"}
+		cached, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+			return m.Metrics(r.Context(), sdk.Query(), lapi, agents, big.NewInt(key.Height))
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error getting metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		metrics = cached.(*m.MetricData)
+	}
+
+	key := cache.Key{ChainID: chainID.Int64(), Height: metrics.Height.Int64(), Endpoint: "apy"}
+	apy, err := cache.Default.GetOrCompute(key, int64(head.Height()), func() (interface{}, error) {
+		return m.Apy(r.Context(), sdk.Query(), big.NewInt(key.Height))
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting apy: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(prom.NewCollector(chainID, metrics, apy.(*big.Float))); err != nil {
+		http.Error(w, fmt.Sprintf("Error registering collector: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(w, r)
+}
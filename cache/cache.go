@@ -0,0 +1,152 @@
+// Package cache provides an LRU cache for metric results keyed by chain height.
+//
+// Results at a finalized height never change, so they are kept until evicted by the LRU bound.
+// Results at heights that could still be reorged expire after a short TTL.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Finality is the number of epochs after which a tipset can no longer be reorged
+const Finality = 900
+
+// Default is the process-wide cache used by the HTTP handlers
+var Default = New(4096, 30*time.Second)
+
+// Key identifies a single metric result
+type Key struct {
+	ChainID  int64
+	Height   int64
+	Endpoint string
+	Params   string
+}
+
+type entry struct {
+	key   Key
+	value interface{}
+	// zero for entries at finalized heights, which never expire
+	expires time.Time
+}
+
+// Cache is a size bounded LRU cache with finality aware expiry. It is safe for concurrent use.
+type Cache struct {
+	mu             sync.Mutex
+	size           int
+	unfinalizedTTL time.Duration
+	ll             *list.List
+	items          map[Key]*list.Element
+
+	// now is overridden in tests
+	now func() time.Time
+}
+
+// New returns a cache holding at most size entries, where entries at unfinalized heights expire after unfinalizedTTL
+func New(size int, unfinalizedTTL time.Duration) *Cache {
+	return &Cache{
+		size:           size,
+		unfinalizedTTL: unfinalizedTTL,
+		ll:             list.New(),
+		items:          make(map[Key]*list.Element),
+		now:            time.Now,
+	}
+}
+
+// Get returns the value cached for key, if present and not expired
+func (c *Cache) Get(key Key) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if !e.expires.IsZero() && !c.now().Before(e.expires) {
+		c.removeElement(el)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// Add caches value under key. head is the current chain head height, used to decide if key.Height is final.
+func (c *Cache) Add(key Key, value interface{}, head int64) {
+	var expires time.Time
+	if head-key.Height < Finality {
+		expires = c.now().Add(c.unfinalizedTTL)
+	}
+
+	c.add(key, value, expires)
+}
+
+// AddFinal caches value under key until evicted by the LRU bound, whatever key.Height is.
+// It is for results that can never change, such as an agent's ID.
+func (c *Cache) AddFinal(key Key, value interface{}) {
+	c.add(key, value, time.Time{})
+}
+
+func (c *Cache) add(key Key, value interface{}, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		e.value = value
+		e.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry{key: key, value: value, expires: expires})
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// GetOrCompute returns the value cached for key, or calls compute and caches its result.
+// Errors are never cached.
+func (c *Cache) GetOrCompute(key Key, head int64, compute func() (interface{}, error)) (interface{}, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+
+	value, err := compute()
+	if err != nil {
+		return nil, err
+	}
+
+	c.Add(key, value, head)
+	return value, nil
+}
+
+// GetOrComputeFinal is GetOrCompute for results that never expire, see AddFinal
+func (c *Cache) GetOrComputeFinal(key Key, compute func() (interface{}, error)) (interface{}, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+
+	value, err := compute()
+	if err != nil {
+		return nil, err
+	}
+
+	c.AddFinal(key, value)
+	return value, nil
+}
+
+// Len returns the number of cached entries, including expired entries that have not been evicted yet
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry).key)
+}
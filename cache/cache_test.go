@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestCache(size int) (*Cache, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	c := New(size, 30*time.Second)
+	c.now = clock.Now
+	return c, clock
+}
+
+func TestExpiry(t *testing.T) {
+	c, clock := newTestCache(10)
+
+	unfinalized := Key{ChainID: 314, Height: 1000, Endpoint: "metrics"}
+	finalized := Key{ChainID: 314, Height: 100, Endpoint: "metrics"}
+	c.Add(unfinalized, "unfinalized", 1000)
+	c.Add(finalized, "finalized", 1000)
+
+	clock.now = clock.now.Add(29 * time.Second)
+	if _, ok := c.Get(unfinalized); !ok {
+		t.Fatal("unfinalized entry should not expire before its TTL")
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	if _, ok := c.Get(unfinalized); ok {
+		t.Fatal("unfinalized entry should expire after its TTL")
+	}
+
+	clock.now = clock.now.Add(24 * time.Hour)
+	if v, ok := c.Get(finalized); !ok || v != "finalized" {
+		t.Fatal("finalized entry should never expire")
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	c, _ := newTestCache(2)
+
+	a := Key{Height: 1, Endpoint: "metrics"}
+	b := Key{Height: 2, Endpoint: "metrics"}
+	d := Key{Height: 3, Endpoint: "metrics"}
+	c.Add(a, "a", 10000)
+	c.Add(b, "b", 10000)
+
+	// touch a so b becomes the least recently used entry
+	if _, ok := c.Get(a); !ok {
+		t.Fatal("a should be cached")
+	}
+	c.Add(d, "d", 10000)
+
+	if _, ok := c.Get(b); ok {
+		t.Fatal("b should have been evicted")
+	}
+	if _, ok := c.Get(a); !ok {
+		t.Fatal("a should still be cached")
+	}
+	if c.Len() != 2 {
+		t.Fatalf("cache should hold 2 entries, got %d", c.Len())
+	}
+}
+
+func TestGetOrCompute(t *testing.T) {
+	c, _ := newTestCache(10)
+	key := Key{ChainID: 314, Height: 1, Endpoint: "miner-info", Params: "f01000"}
+
+	calls := 0
+	compute := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		v, err := c.GetOrCompute(key, 10000, compute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != 1 {
+			t.Fatalf("expected the first computed value, got %v", v)
+		}
+	}
+
+	errKey := Key{ChainID: 314, Height: 2, Endpoint: "miner-info"}
+	_, err := c.GetOrCompute(errKey, 10000, func() (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, ok := c.Get(errKey); ok {
+		t.Fatal("errors should not be cached")
+	}
+}
+
+func TestGetOrComputeFinal(t *testing.T) {
+	c, clock := newTestCache(10)
+	// a key without a height would count as unfinalized for Add
+	key := Key{ChainID: 314, Endpoint: "agent", Params: "1"}
+
+	calls := 0
+	compute := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+
+	if _, err := c.GetOrComputeFinal(key, compute); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.now = clock.now.Add(24 * time.Hour)
+	v, err := c.GetOrComputeFinal(key, compute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 1 {
+		t.Fatalf("final entry should never expire, got %v", v)
+	}
+}
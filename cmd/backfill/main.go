@@ -0,0 +1,184 @@
+// Command backfill computes metric snapshots over a range of heights and saves them to the snapshot store.
+// Heights that are already stored are skipped, so an interrupted backfill resumes where it stopped.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"math/big"
+	"os/signal"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/glifio/go-pools/constants"
+	psdk "github.com/glifio/go-pools/sdk"
+	"github.com/glifio/pools-metrics/cache"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+	"github.com/glifio/pools-metrics/store"
+)
+
+func main() {
+	chainIDFlag := flag.Int64("chain-id", constants.MainnetChainID, "chain ID to backfill")
+	from := flag.Int64("from", -1, "first height to backfill, defaults to the first height with a deployed agent")
+	to := flag.Int64("to", -1, "last height to backfill, defaults to the latest final tipset")
+	step := flag.Int64("step", builtin.EpochsInDay, "number of epochs between snapshots")
+	dbPath := flag.String("db", "metrics.db", "path of the snapshot history database")
+	lotusAddr := flag.String("lotus", "", "Lotus JSON-RPC dial address, defaults to the chain's public endpoint")
+	lotusToken := flag.String("lotus-token", "", "Lotus API token")
+	flag.Parse()
+
+	if *step <= 0 {
+		log.Fatal("step must be greater than 0")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	chainID := big.NewInt(*chainIDFlag)
+	extern, err := common.GetExtern(chainID)
+	if err != nil {
+		log.Fatalf("Error getting extern: %v", err)
+	}
+	agents, err := shared.GetAgentLister(chainID)
+	if err != nil {
+		log.Fatalf("Error getting agent list: %v", err)
+	}
+	if *lotusAddr != "" {
+		extern.LotusDialAddr = *lotusAddr
+		extern.LotusToken = *lotusToken
+	}
+
+	sdk, err := psdk.New(ctx, chainID, extern)
+	if err != nil {
+		log.Fatalf("Error initializing PoolsSDK: %v", err)
+	}
+
+	lapi, closer, err := sdk.Extern().ConnectLotusClient()
+	if err != nil {
+		log.Fatalf("Error connecting to Lotus: %v", err)
+	}
+	defer closer()
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		log.Fatalf("Error opening snapshot store: %v", err)
+	}
+	defer st.Close()
+
+	head, err := lapi.ChainHead(ctx)
+	if err != nil {
+		log.Fatalf("Error getting chain head: %v", err)
+	}
+	// only final tipsets are stored, a reorg could still replace anything newer
+	final := int64(head.Height()) - cache.Finality
+	if *to < 0 || *to > final {
+		*to = final
+	}
+
+	if *from < 0 {
+		first, ok, err := firstAgentHeight(ctx, sdk.Query(), lapi, *to)
+		if err != nil {
+			log.Fatalf("Error finding the first agent: %v", err)
+		}
+		if !ok {
+			log.Printf("no agent deployed by height %d, nothing to backfill", *to)
+			return
+		}
+		*from = first
+	}
+
+	for height := *from; height <= *to; height += *step {
+		if ctx.Err() != nil {
+			log.Printf("interrupted before height %d, rerun to resume", height)
+			return
+		}
+
+		// null rounds resolve to an earlier tipset, which is the height the snapshot is stored under
+		ts, err := m.ResolveTipSet(ctx, lapi, big.NewInt(height))
+		if err != nil {
+			log.Fatalf("Error resolving tipset at %d: %v", height, err)
+		}
+
+		stored, err := st.Has(chainID, int64(ts.Height()))
+		if err != nil {
+			log.Fatalf("Error reading snapshot store: %v", err)
+		}
+		if stored {
+			continue
+		}
+
+		deployed, err := agentsDeployed(ctx, sdk.Query(), int64(ts.Height()))
+		if err != nil {
+			log.Fatalf("Error reading agent count at %d: %v", height, err)
+		}
+		if !deployed {
+			continue
+		}
+
+		metrics, err := m.Metrics(ctx, sdk.Query(), lapi, agents, big.NewInt(int64(ts.Height())))
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("interrupted at height %d, rerun to resume", height)
+				return
+			}
+			log.Fatalf("Error computing metrics at %d: %v", height, err)
+		}
+
+		if err := st.Put(chainID, metrics); err != nil {
+			log.Fatalf("Error saving snapshot at %d: %v", height, err)
+		}
+		log.Printf("stored snapshot at height %d", ts.Height())
+	}
+}
+
+// agentsDeployed reports whether the agent factory had deployed an agent at height.
+// Before the pool's contracts are deployed, reading them fails with bind.ErrNoCode.
+func agentsDeployed(ctx context.Context, q m.PoolQuerier, height int64) (bool, error) {
+	count, err := q.AgentFactoryAgentCount(ctx, big.NewInt(height))
+	if errors.Is(err, bind.ErrNoCode) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return count.Sign() > 0, nil
+}
+
+// firstAgentHeight binary searches for the first height at or below to with a deployed agent
+func firstAgentHeight(ctx context.Context, q m.PoolQuerier, lapi m.LotusAPI, to int64) (int64, bool, error) {
+	deployedAt := func(height int64) (bool, error) {
+		// null rounds resolve to the tipset before them
+		ts, err := m.ResolveTipSet(ctx, lapi, big.NewInt(height))
+		if err != nil {
+			return false, err
+		}
+		return agentsDeployed(ctx, q, int64(ts.Height()))
+	}
+
+	deployed, err := deployedAt(to)
+	if err != nil || !deployed {
+		return 0, false, err
+	}
+
+	lo, hi := int64(0), to
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		deployed, err := deployedAt(mid)
+		if err != nil {
+			return 0, false, err
+		}
+		if deployed {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	return lo, true, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/filecoin-project/go-address"
+	handler "github.com/glifio/pools-metrics/api/v0"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+)
+
+func runMetrics(ctx context.Context, opts *options) (interface{}, [][2]string, error) {
+	agents, err := shared.GetAgentLister(opts.chainID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metrics, err := m.Metrics(ctx, opts.sdk.Query(), opts.lapi, agents, opts.blockNumber)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error getting metrics: %v", err)
+	}
+
+	res := handler.EncodeMetrics(metrics, opts.shouldConvert())
+	rows := [][2]string{
+		{"Pool total assets", res.PoolTotalAssets},
+		{"Pool total borrowed", res.PoolTotalBorrowed},
+		{"Pool borrowable assets", res.PoolTotalBorrowableAssets},
+		{"Pool exit reserve", res.PoolExitReserve},
+		{"Agents", strconv.FormatUint(res.TotalAgentCount, 10)},
+		{"Miners", strconv.FormatUint(res.TotalMinersCount, 10)},
+		{"Miner collaterals", res.TotalMinerCollaterals},
+		{"Live sectors", res.TotalMinersSectors},
+		{"Active sectors", res.TotalActiveSectors},
+		{"Faulty sectors", res.TotalFaultySectors},
+		{"Recovering sectors", res.TotalRecoveringSectors},
+		{"Miner QAP", res.TotalMinerQAP},
+		{"Miner RBP", res.TotalMinerRBP},
+		{"Network QAP", res.NetworkQAP},
+		{"Network RBP", res.NetworkRBP},
+		{"QAP share", res.QAPShare},
+		{"RBP share", res.RBPShare},
+		{"Block reward share", res.BlockRewardShare},
+		{"Total value locked", res.TotalValueLocked},
+		{"Utilization", res.Utilization},
+		{"Borrowable share", res.BorrowableShare},
+		{"Exit reserve coverage", res.ExitReserveCoverage},
+		{"Withdrawable liquidity", res.WithdrawableLiquidity},
+		{"Denom", res.Denom},
+		{"Block number", strconv.FormatUint(res.BlockNumber, 10)},
+		{"Tipset", res.TipSetKey.String()},
+		{"Timestamp", strconv.FormatUint(res.Timestamp, 10)},
+	}
+
+	return res, rows, nil
+}
+
+func runApy(ctx context.Context, opts *options) (interface{}, [][2]string, error) {
+	apy, err := m.Apy(ctx, opts.sdk.Query(), opts.blockNumber)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error getting apy: %v", err)
+	}
+
+	realized, err := m.RealizedApys(ctx, opts.sdk.Query(), opts.lapi, opts.blockNumber)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error getting realized apy: %v", err)
+	}
+
+	res := handler.EncodeApy(apy, realized)
+	rows := [][2]string{
+		{"APY", fmt.Sprintf("%0.03f%%", res.Apy)},
+	}
+	for _, apy := range res.Realized {
+		if apy.Apy != nil {
+			rows = append(rows, [2]string{fmt.Sprintf("Realized %d day APY", apy.Days), fmt.Sprintf("%0.03f%%", apy.Apy)})
+		}
+	}
+
+	return res, rows, nil
+}
+
+func runMiners(ctx context.Context, opts *options) (interface{}, [][2]string, error) {
+	minerCount, miners, err := m.Miners(ctx, opts.sdk.Query(), opts.blockNumber)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error getting miners: %v", err)
+	}
+
+	res := &handler.MinersRes{
+		Miners: miners,
+		Count:  minerCount.Uint64(),
+	}
+	rows := make([][2]string, 0, len(miners)+1)
+	rows = append(rows, [2]string{"Count", minerCount.String()})
+	for i, miner := range miners {
+		rows = append(rows, [2]string{strconv.Itoa(i + 1), miner.String()})
+	}
+
+	return res, rows, nil
+}
+
+func runMinerInfo(ctx context.Context, opts *options) (interface{}, [][2]string, error) {
+	if opts.miner == "" {
+		return nil, nil, errors.New("--miner is required")
+	}
+
+	minerAddr, err := address.NewFromString(opts.miner)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing miner address: %v", err)
+	}
+
+	info, err := m.MinerInfoAt(ctx, opts.rates, opts.lapi, m.NewMinerStats(opts.lapi), minerAddr, opts.blockNumber)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error getting miner max borrow: %v", err)
+	}
+
+	res := handler.EncodeMinerInfo(info.MaxBorrow, info.AgentValue, info.EDR, common.AnnualizeRate(info.Rate), opts.shouldConvert())
+	res.BlockNumber = info.Height.Uint64()
+	res.TipSetKey = info.TipSetKey
+	res.Timestamp = info.Timestamp
+	rows := [][2]string{
+		{"Borrow start", res.BorrowStart},
+		{"Borrow cap", res.BorrowCap},
+		{"Expected daily rewards", res.ExpectedDailyRewards},
+		{"Equity", res.Equity},
+		{"Annual fee rate", res.AnnualFeeRate},
+		{"Denom", res.Denom},
+		{"Block number", strconv.FormatUint(res.BlockNumber, 10)},
+	}
+
+	if opts.explain {
+		res.Explain = handler.EncodeMinerInfoExplain(info, opts.shouldConvert())
+		explain := res.Explain
+		rows = append(rows, [][2]string{
+			{"Lazy expected daily rewards", explain.LazyExpectedDailyRewards},
+			{"Vesting funds", explain.VestingFunds},
+			{"Vesting days", strconv.FormatInt(explain.VestingDays, 10)},
+			{"Vesting component", explain.VestingComponent},
+			{"Agent value", explain.AgentData.AgentValue},
+			{"Collateral value", explain.AgentData.CollateralValue},
+			{"Expected daily fault penalties", explain.AgentData.ExpectedDailyFaultPenalties},
+			{"Credential expected daily rewards", explain.AgentData.ExpectedDailyRewards},
+			{"GCRED", explain.AgentData.Gcred},
+			{"QA power", explain.AgentData.QaPower},
+			{"Principal", explain.AgentData.Principal},
+			{"Faulty sectors", explain.AgentData.FaultySectors},
+			{"Live sectors", explain.AgentData.LiveSectors},
+			{"Green score", explain.AgentData.GreenScore},
+			{"Per-epoch rate", explain.Rate},
+		}...)
+	}
+
+	return res, rows, nil
+}
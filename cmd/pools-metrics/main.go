@@ -0,0 +1,165 @@
+// Command pools-metrics computes the pool metrics from the command line,
+// using the same code paths as the api/v0 HTTP handlers.
+//
+// Usage:
+//
+//	pools-metrics <metrics|apy|miners|miner-info> [flags]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/glifio/go-pools/constants"
+	psdk "github.com/glifio/go-pools/sdk"
+	pooltypes "github.com/glifio/go-pools/types"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/shared"
+)
+
+type command struct {
+	name  string
+	usage string
+	// whether run reads its inputs at --height, commands that don't reject the flag
+	atHeight bool
+	run      func(ctx context.Context, opts *options) (interface{}, [][2]string, error)
+}
+
+var commands = []command{
+	{name: "metrics", usage: "pool and miner totals", atHeight: true, run: runMetrics},
+	{name: "apy", usage: "the infinity pool apy", atHeight: true, run: runApy},
+	{name: "miners", usage: "every miner pledged to the pool", atHeight: true, run: runMiners},
+	{name: "miner-info", usage: "borrow cap and rate for a miner (requires --miner)", atHeight: true, run: runMinerInfo},
+}
+
+// options holds the flags shared by every subcommand
+type options struct {
+	chainID     *big.Int
+	blockNumber *big.Int
+	denom       string
+	miner       string
+	explain     bool
+	json        bool
+
+	sdk   pooltypes.PoolsSDK
+	lapi  *api.FullNodeStruct
+	rates m.PoolRateQuerier
+}
+
+func (o *options) shouldConvert() bool {
+	return strings.ToLower(o.denom) == "fil"
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == os.Args[1] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := run(cmd, os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: pools-metrics <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+func run(cmd *command, args []string) error {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	chainID := fs.Int64("chain-id", constants.MainnetChainID, "chain ID to query")
+	height := fs.Int64("height", -1, "block height to read every input at, defaults to the chain head")
+	denom := fs.String("denom", "attofil", "denomination of FIL values, attofil or fil")
+	miner := fs.String("miner", "", "miner address, used by miner-info")
+	explain := fs.Bool("explain", false, "show every input of the borrow cap, used by miner-info")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := &options{
+		chainID: big.NewInt(*chainID),
+		denom:   *denom,
+		miner:   *miner,
+		explain: *explain,
+		json:    *asJSON,
+	}
+	if !common.SupportedNetwork(opts.chainID) {
+		return errors.New("Unsupported chainID")
+	}
+	if *height >= 0 {
+		if !cmd.atHeight {
+			return fmt.Errorf("%s does not support --height", cmd.name)
+		}
+		opts.blockNumber = big.NewInt(*height)
+	}
+
+	ctx := context.Background()
+
+	extern, err := common.GetExtern(opts.chainID)
+	if err != nil {
+		return err
+	}
+
+	opts.sdk, err = psdk.New(ctx, opts.chainID, extern)
+	if err != nil {
+		return fmt.Errorf("Error initializing PoolsSDK: %v", err)
+	}
+
+	lapi, closer, err := opts.sdk.Extern().ConnectLotusClient()
+	if err != nil {
+		return fmt.Errorf("Error connecting to Lotus: %v", err)
+	}
+	defer closer()
+	opts.lapi = lapi
+
+	rates, closeRates, err := shared.ConnectPoolRates(opts.sdk)
+	if err != nil {
+		return fmt.Errorf("Error connecting to the pool's rate module: %v", err)
+	}
+	defer closeRates()
+	opts.rates = rates
+
+	res, rows, err := cmd.run(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%s\n", row[0], row[1])
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,130 @@
+// Command server runs the api/v0 handlers as a single long running HTTP server,
+// sharing one SDK and Lotus connection across every request.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"math/big"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/glifio/go-pools/constants"
+	psdk "github.com/glifio/go-pools/sdk"
+	handler "github.com/glifio/pools-metrics/api/v0"
+	"github.com/glifio/pools-metrics/common"
+	"github.com/glifio/pools-metrics/shared"
+	"github.com/glifio/pools-metrics/store"
+	"github.com/glifio/pools-metrics/worker"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	chainIDFlag := flag.Int64("chain-id", constants.MainnetChainID, "chain ID served by the shared SDK")
+	lotusAddr := flag.String("lotus", "", "Lotus JSON-RPC dial address, defaults to the chain's public endpoint")
+	lotusToken := flag.String("lotus-token", "", "Lotus API token")
+	precompute := flag.Bool("precompute", true, "precompute metrics for every new tipset in the background")
+	pollInterval := flag.Duration("poll-interval", 10*time.Second, "how often the background worker polls the chain head")
+	dbPath := flag.String("db", "", "path of the snapshot history database, snapshots are not persisted if empty")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "time to wait for in-flight requests on shutdown")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	chainID := big.NewInt(*chainIDFlag)
+	extern, err := common.GetExtern(chainID)
+	if err != nil {
+		log.Fatalf("Error getting extern: %v", err)
+	}
+	if *lotusAddr != "" {
+		extern.LotusDialAddr = *lotusAddr
+		extern.LotusToken = *lotusToken
+	}
+
+	sdk, err := psdk.New(ctx, chainID, extern)
+	if err != nil {
+		log.Fatalf("Error initializing PoolsSDK: %v", err)
+	}
+
+	lapi, closer, err := sdk.Extern().ConnectLotusClient()
+	if err != nil {
+		log.Fatalf("Error connecting to Lotus: %v", err)
+	}
+	defer closer()
+
+	shared.Set(chainID, sdk, lapi)
+
+	if *dbPath != "" {
+		st, err := store.Open(*dbPath)
+		if err != nil {
+			log.Fatalf("Error opening snapshot store: %v", err)
+		}
+		defer st.Close()
+		store.SetDefault(st)
+	}
+
+	if *precompute {
+		agents, err := shared.GetAgentLister(chainID)
+		if err != nil {
+			log.Fatalf("Error getting agent list: %v", err)
+		}
+		w := worker.New(chainID, sdk.Query(), lapi, agents, *pollInterval)
+		if st := store.Default(); st != nil {
+			w.PersistTo(st)
+		}
+		worker.Register(w)
+		go w.Run(ctx)
+	}
+
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: newRouter(),
+	}
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		log.Println("shutting down")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
+	log.Printf("listening on %s for chain %s", *addr, chainID)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Error serving: %v", err)
+	}
+	// wait for in-flight requests to drain before closing the shared Lotus connection
+	<-shutdownDone
+}
+
+func newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", handler.Metrics)
+	mux.HandleFunc("/metrics/history", handler.MetricsHistory)
+	mux.HandleFunc("/apy", handler.Apy)
+	mux.HandleFunc("/ifil", handler.IFIL)
+	mux.HandleFunc("/prom", handler.Prom)
+	mux.HandleFunc("/agents", handler.Agents)
+	mux.HandleFunc("/agent-info", handler.AgentInfo)
+	mux.HandleFunc("/leverage", handler.Leverage)
+	mux.HandleFunc("/concentration", handler.Concentration)
+	mux.HandleFunc("/miners", handler.Miners)
+	mux.HandleFunc("/miners/breakdown", handler.MinersBreakdown)
+	mux.HandleFunc("/faults", handler.Faults)
+	mux.HandleFunc("/miner-info", handler.MinerInfo)
+	mux.HandleFunc("/miner-info/batch", handler.MinerInfoBatch)
+	mux.HandleFunc("/miner-max-borrow", handler.MinerMaxBorrow)
+	mux.HandleFunc("/miner-collaterals", handler.MinerCollaterals)
+	mux.HandleFunc("/borrow-quote", handler.BorrowQuote)
+	return mux
+}
@@ -9,14 +9,13 @@ import (
 
 	"github.com/glifio/go-pools/constants"
 	"github.com/glifio/go-pools/deploy"
-	psdk "github.com/glifio/go-pools/sdk"
 	"github.com/glifio/go-pools/types"
 	pooltypes "github.com/glifio/go-pools/types"
 	"github.com/glifio/go-pools/util"
 )
 
-// default to mainnet
-var chainID = big.NewInt(constants.MainnetChainID)
+// chain requests read from when they don't pass a chainID
+var defaultChainID = big.NewInt(constants.MainnetChainID)
 
 func SupportedNetwork(chainID *big.Int) bool {
 	switch chainID.Int64() {
@@ -33,18 +32,19 @@ func SupportedNetwork(chainID *big.Int) bool {
 
 func GetChainID(qparams url.Values) (*big.Int, error) {
 	chainIDStr := qparams.Get("chainID")
-	if chainIDStr != "" {
-		id, ok := new(big.Int).SetString(chainIDStr, 10)
-		if !ok {
-			return nil, errors.New("Error getting chainID")
-		}
-		if !SupportedNetwork(id) {
-			return nil, errors.New("Unsupported chainID")
-		}
-		chainID = id
+	if chainIDStr == "" {
+		return new(big.Int).Set(defaultChainID), nil
+	}
+
+	id, ok := new(big.Int).SetString(chainIDStr, 10)
+	if !ok {
+		return nil, errors.New("Error getting chainID")
+	}
+	if !SupportedNetwork(id) {
+		return nil, errors.New("Unsupported chainID")
 	}
 
-	return chainID, nil
+	return id, nil
 }
 
 func GetExtern(chainID *big.Int) (pooltypes.Extern, error) {
@@ -58,25 +58,26 @@ func GetExtern(chainID *big.Int) (pooltypes.Extern, error) {
 	}
 }
 
-func NewSDK(r *http.Request) (pooltypes.PoolsSDK, error) {
-	chainID, err := GetChainID(r.URL.Query())
-	if err != nil {
-		return nil, err
-	}
+func FmtFILVal(val *big.Int) string {
+	inFIL := util.ToFIL(val)
+	return fmt.Sprintf("%0.03f", inFIL)
+}
 
-	extern, err := GetExtern(chainID)
-	if err != nil {
-		return nil, err
+// FmtRatio formats an exact ratio as a decimal, 0.1 is 10%
+func FmtRatio(val *big.Rat) string {
+	if val == nil {
+		return ""
 	}
-	ctx := r.Context()
-
-	sdk, err := psdk.New(ctx, chainID, extern)
-	return sdk, nil
+	return val.FloatString(18)
 }
 
-func FmtFILVal(val *big.Int) string {
-	inFIL := util.ToFIL(val)
-	return fmt.Sprintf("%0.03f", inFIL)
+// AnnualizeRate converts a per-epoch WAD rate into an annual percentage
+func AnnualizeRate(rate *big.Int) *big.Float {
+	annual := new(big.Int).Mul(rate, big.NewInt(constants.EpochsInYear))
+	annual.Div(annual, constants.WAD)
+	filRate := util.ToFIL(annual)
+	// make a rate a percentage
+	return filRate.Mul(filRate, big.NewFloat(100))
 }
 
 func GetBlockNumberQP(r *http.Request) (*big.Int, error) {
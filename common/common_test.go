@@ -0,0 +1,31 @@
+package common
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/glifio/go-pools/constants"
+)
+
+func TestGetChainIDDoesNotChangeDefault(t *testing.T) {
+	id, err := GetChainID(url.Values{"chainID": {"314159"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Int64() != constants.CalibnetChainID {
+		t.Fatalf("got chainID %s, want %d", id, constants.CalibnetChainID)
+	}
+
+	// a later request without a chainID still reads from mainnet
+	id, err = GetChainID(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Int64() != constants.MainnetChainID {
+		t.Fatalf("got default chainID %s, want %d", id, constants.MainnetChainID)
+	}
+
+	if _, err := GetChainID(url.Values{"chainID": {"1"}}); err == nil {
+		t.Fatal("expected an error for an unsupported chainID")
+	}
+}
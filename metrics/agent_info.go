@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/go-pools/util"
+	"github.com/glifio/go-pools/vc"
+)
+
+// AgentInfoData is an agent's borrow cap and rate at a tipset, evaluated across every miner pledged to it
+type AgentInfoData struct {
+	ID      uint64
+	Address common.Address
+	Miners  []*AgentMinerInfo
+	// summed actor balances of the agent's miners
+	MinerBalance *big.Int
+	LiquidAssets *big.Int
+	Principal    *big.Int
+	// miner balances plus liquid assets
+	AgentValue *big.Int
+	// summed expected daily rewards of the agent's miners, each including a day of its vesting funds
+	EDR *big.Int
+	// borrow cap for the agent's total principal, Principal plus RemainingCapacity
+	MaxBorrow *big.Int
+	// FIL the agent can borrow on top of its principal, the result of psdk.MaxBorrowFromAgentData
+	RemainingCapacity *big.Int
+	// per-epoch WAD rate
+	Rate *big.Int
+	// sent to vc.NullishVerifiableCredential to get the rate, and to psdk.MaxBorrowFromAgentData
+	AgentData *vc.AgentData
+
+	Height    *big.Int
+	TipSetKey types.TipSetKey
+	Timestamp uint64
+}
+
+// AgentMinerInfo is a single miner's contribution to its agent's borrow cap
+type AgentMinerInfo struct {
+	Miner   address.Address
+	Balance *big.Int
+	EDR     *big.Int
+}
+
+var (
+	// ErrInvalidAgent is returned when an agent reference is neither an agent ID nor a 0x address
+	ErrInvalidAgent = errors.New("invalid agent")
+	// ErrAgentNotFound is returned when no deployed agent matches an agent reference
+	ErrAgentNotFound = errors.New("agent not found")
+)
+
+// ResolveAgent finds an agent by its ID or 0x address
+func ResolveAgent(ctx context.Context, agents AgentLister, agent string) (*Agent, error) {
+	var match func(a *Agent) bool
+	if strings.HasPrefix(agent, "0x") {
+		if !common.IsHexAddress(agent) {
+			return nil, fmt.Errorf("%w address %q", ErrInvalidAgent, agent)
+		}
+		addr := common.HexToAddress(agent)
+		match = func(a *Agent) bool { return a.Address == addr }
+	} else {
+		id, err := strconv.ParseUint(agent, 10, 64)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("%w ID %q", ErrInvalidAgent, agent)
+		}
+		match = func(a *Agent) bool { return a.ID == id }
+	}
+
+	list, err := agents.ListAgents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		if match(&list[i]) {
+			return &list[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrAgentNotFound, agent)
+}
+
+// AgentInfo computes an agent's borrow cap, rate and remaining borrowing capacity with every input evaluated at blockNumber
+func AgentInfo(ctx context.Context, q PoolRateQuerier, lapi LotusAPI, stats MinerStatsAPI, agent *Agent, blockNumber *big.Int) (*AgentInfoData, error) {
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return agentInfoAtTipSet(ctx, q, lapi, stats, agent, ts)
+}
+
+// agentInfoAtTipSet computes an agent's borrow cap and rate at an already resolved tipset
+func agentInfoAtTipSet(ctx context.Context, q PoolRateQuerier, lapi LotusAPI, stats MinerStatsAPI, agent *Agent, ts *types.TipSet) (*AgentInfoData, error) {
+	height := tipSetBlockNumber(ts)
+
+	agentCount, err := q.AgentFactoryAgentCount(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	if agent.ID > agentCount.Uint64() {
+		return nil, fmt.Errorf("%w: agent %d was not deployed at height %s", ErrAgentNotFound, agent.ID, height)
+	}
+
+	miners, err := q.MinerRegistryAgentMinersList(ctx, new(big.Int).SetUint64(agent.ID), height)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]util.TaskFunc, len(miners))
+	for i, miner := range miners {
+		tasks[i] = createMinerInfoInputsTask(ctx, lapi, stats, miner, ts)
+	}
+
+	results, err := util.Multiread(tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	liquidAssets, err := q.AgentLiquidAssets(ctx, agent.Address, height)
+	if err != nil {
+		return nil, err
+	}
+
+	principal, err := q.AgentPrincipal(ctx, agent.Address, height)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &AgentInfoData{
+		ID:           agent.ID,
+		Address:      agent.Address,
+		Miners:       make([]*AgentMinerInfo, len(results)),
+		MinerBalance: big.NewInt(0),
+		LiquidAssets: liquidAssets,
+		Principal:    principal,
+		EDR:          big.NewInt(0),
+		Height:       height,
+		TipSetKey:    ts.Key(),
+		Timestamp:    ts.MinTimestamp(),
+	}
+	for i, result := range results {
+		inputs := result.(*MinerInfoInputs)
+		data.Miners[i] = &AgentMinerInfo{
+			Miner:   miners[i],
+			Balance: inputs.AgentData.AgentValue,
+			EDR:     inputs.AgentData.ExpectedDailyRewards,
+		}
+		data.MinerBalance.Add(data.MinerBalance, inputs.AgentData.AgentValue)
+		data.EDR.Add(data.EDR, inputs.AgentData.ExpectedDailyRewards)
+	}
+	data.AgentValue = new(big.Int).Add(data.MinerBalance, liquidAssets)
+
+	// the same agent data as miner info, valued across the whole agent and carrying its principal
+	data.AgentData = &vc.AgentData{
+		AgentValue:                  data.AgentValue,
+		CollateralValue:             big.NewInt(0),
+		ExpectedDailyFaultPenalties: big.NewInt(0),
+		ExpectedDailyRewards:        data.EDR,
+		Gcred:                       big.NewInt(100),
+		QaPower:                     big.NewInt(0),
+		Principal:                   principal,
+		FaultySectors:               big.NewInt(0),
+		LiveSectors:                 big.NewInt(0),
+		GreenScore:                  big.NewInt(0),
+	}
+
+	data.Rate, err = q.InfPoolGetRateAt(ctx, data.AgentData, height)
+	if err != nil {
+		return nil, err
+	}
+
+	// the max borrow formula already nets out the principal the agent data carries
+	data.RemainingCapacity = q.MaxBorrowFromAgentData(data.AgentData, data.Rate)
+	data.MaxBorrow = new(big.Int).Add(principal, data.RemainingCapacity)
+
+	return data, nil
+}
+
+func createMinerInfoInputsTask(ctx context.Context, lapi LotusAPI, stats MinerStatsAPI, miner address.Address, ts *types.TipSet) util.TaskFunc {
+	return func() (interface{}, error) {
+		return minerInfoInputsAt(ctx, lapi, stats, miner, ts)
+	}
+}
+
+// minerAgentAt returns the agent miner is pledged to at height, or nil when it is not pledged to any
+func minerAgentAt(ctx context.Context, q PoolQuerier, agents AgentLister, miner address.Address, height *big.Int) (*Agent, error) {
+	agentCount, err := q.AgentFactoryAgentCount(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]util.TaskFunc, agentCount.Int64())
+	for i := int64(0); i < agentCount.Int64(); i++ {
+		// agent ids start at 1
+		id := big.NewInt(i + 1)
+		tasks[i] = func() (interface{}, error) {
+			return q.MinerRegistryAgentMinersList(ctx, id, height)
+		}
+	}
+
+	results, err := util.Multiread(tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, result := range results {
+		for _, pledged := range result.([]address.Address) {
+			if pledged == miner {
+				return ResolveAgent(ctx, agents, strconv.Itoa(i+1))
+			}
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	psdk "github.com/glifio/go-pools/sdk"
+)
+
+func TestAgentInfo(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	byID, err := ResolveAgent(ctx, env.agents, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byAddress, err := ResolveAgent(ctx, env.agents, byID.Address.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byAddress.ID != 1 {
+		t.Fatalf("resolved agent %d by address, want 1", byAddress.ID)
+	}
+
+	data, err := AgentInfo(ctx, env.pool, env.lapi, env.stats, byID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data.Miners) != 2 {
+		t.Fatalf("expected 2 miners, got %d", len(data.Miners))
+	}
+	assertBigInt(t, "Miners[1].Balance", data.Miners[1].Balance, fil("500"))
+	// 1 FIL lazy EDR + 90 FIL vesting / 180 days
+	assertBigInt(t, "Miners[1].EDR", data.Miners[1].EDR, fil("1.5"))
+
+	assertBigInt(t, "MinerBalance", data.MinerBalance, fil("1500"))
+	assertBigInt(t, "LiquidAssets", data.LiquidAssets, fil("10"))
+	assertBigInt(t, "Principal", data.Principal, fil("1000"))
+	assertBigInt(t, "AgentValue", data.AgentValue, fil("1510"))
+	assertBigInt(t, "EDR", data.EDR, fil("4.5"))
+	// the fake pool charges a premium of the rate scaled by the 1000 / 1510 principal to value ratio
+	assertBigInt(t, "Rate", data.Rate, premiumRate(1000, 1510))
+	assertBigInt(t, "AgentData.Principal", data.AgentData.Principal, fil("1000"))
+
+	// twice the 510 FIL of equity caps the total principal at 1020 FIL, below the payment limit of
+	// 4.5 FIL of daily rewards at the rate, leaving 20 FIL on top of the 1000 FIL borrowed
+	assertBigInt(t, "MaxBorrow", data.MaxBorrow, fil("1020"))
+	assertBigInt(t, "RemainingCapacity", data.RemainingCapacity, fil("20"))
+}
+
+func TestAgentInfoRateModule(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	chain := newRateModuleChain(func(blockNumber *big.Int) *big.Int { return env.fixture.RateAt(blockNumber).Int })
+	q := NewPoolRateQuerier(env.pool, NewRateModule(chain, chain.pool))
+
+	agent, err := ResolveAgent(ctx, env.agents, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := AgentInfo(ctx, q, env.lapi, env.stats, agent, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain.assertCredential(t, data.AgentData)
+	assertBigInt(t, "RemainingCapacity", data.RemainingCapacity, psdk.MaxBorrowFromAgentData(data.AgentData, data.Rate))
+	assertBigInt(t, "MaxBorrow", data.MaxBorrow, new(big.Int).Add(data.Principal, data.RemainingCapacity))
+
+	// repaying the principal out of the agent's value leaves its equity unchanged,
+	// so it can only raise the capacity if the max borrow formula nets out the principal
+	repaid := *data.AgentData
+	repaid.AgentValue = new(big.Int).Sub(data.AgentData.AgentValue, data.AgentData.Principal)
+	repaid.Principal = big.NewInt(0)
+	if psdk.MaxBorrowFromAgentData(&repaid, data.Rate).Cmp(data.RemainingCapacity) <= 0 {
+		t.Fatalf("RemainingCapacity %v should be net of the %v principal", data.RemainingCapacity, data.Principal)
+	}
+}
+
+func TestResolveAgentErrors(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	for agent, want := range map[string]error{
+		"0":      ErrInvalidAgent,
+		"abc":    ErrInvalidAgent,
+		"0x1234": ErrInvalidAgent,
+		"42":     ErrAgentNotFound,
+		"0x00000000000000000000000000000000000000ff": ErrAgentNotFound,
+	} {
+		if _, err := ResolveAgent(ctx, env.agents, agent); !errors.Is(err, want) {
+			t.Fatalf("resolving agent %q: got %v, want %v", agent, err, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/go-pools/util"
+)
+
+// AgentBreakdown is a single agent's share of the pool's aggregate metrics
+type AgentBreakdown struct {
+	ID      uint64            `json:"id"`
+	Address common.Address    `json:"address"`
+	Miners  []address.Address `json:"miners"`
+	// summed actor balances of the agent's miners
+	MinerBalance *big.Int `json:"minerBalance"`
+	LiquidAssets *big.Int `json:"liquidAssets"`
+	Principal    *big.Int `json:"principal"`
+	QAP          *big.Int `json:"qap"`
+	RBP          *big.Int `json:"rbp"`
+	// miner balances plus liquid assets, minus the principal owed to the pool
+	Equity *big.Int `json:"equity"`
+}
+
+// Agents breaks the pool's miner collaterals and power down by agent at blockNumber
+func Agents(ctx context.Context, q PoolQuerier, lapi LotusAPI, agents AgentLister, blockNumber *big.Int) ([]*AgentBreakdown, error) {
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdowns, _, err := agentBreakdownsAt(ctx, q, lapi, agents, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	return breakdowns, nil
+}
+
+// agentBreakdownsAt breaks the pool down by agent at ts, also returning the pledged miners it was built from
+func agentBreakdownsAt(ctx context.Context, q PoolQuerier, lapi LotusAPI, agents AgentLister, ts *types.TipSet) ([]*AgentBreakdown, []*pledgedMiner, error) {
+	blockNumber := tipSetBlockNumber(ts)
+
+	agentCount, miners, err := pledgedMinersAt(ctx, q, lapi, ts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := agents.ListAgents(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var breakdowns []*AgentBreakdown
+	byID := make(map[uint64]*AgentBreakdown)
+	for _, agent := range data {
+		// skip agents deployed after the requested height
+		if agent.ID == 0 || agent.ID > agentCount.Uint64() {
+			continue
+		}
+		breakdown := &AgentBreakdown{
+			ID:           agent.ID,
+			Address:      agent.Address,
+			Miners:       []address.Address{},
+			MinerBalance: big.NewInt(0),
+			QAP:          big.NewInt(0),
+			RBP:          big.NewInt(0),
+		}
+		breakdowns = append(breakdowns, breakdown)
+		byID[agent.ID] = breakdown
+	}
+
+	sort.Slice(breakdowns, func(i, j int) bool {
+		return breakdowns[i].ID < breakdowns[j].ID
+	})
+
+	for _, miner := range miners {
+		breakdown, ok := byID[miner.agentID]
+		if !ok {
+			continue
+		}
+		breakdown.Miners = append(breakdown.Miners, miner.miner)
+		breakdown.MinerBalance.Add(breakdown.MinerBalance, miner.balance)
+		breakdown.QAP.Add(breakdown.QAP, miner.power.qap)
+		breakdown.RBP.Add(breakdown.RBP, miner.power.rbp)
+	}
+
+	tasks := make([]util.TaskFunc, len(breakdowns))
+	for i, breakdown := range breakdowns {
+		tasks[i] = createAgentLiquidAssetTask(ctx, q, breakdown.Address, blockNumber)
+	}
+
+	liquidAssets, err := util.Multiread(tasks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tasks = make([]util.TaskFunc, len(breakdowns))
+	for i, breakdown := range breakdowns {
+		tasks[i] = createAgentPrincipalTask(ctx, q, breakdown.Address, blockNumber)
+	}
+
+	principals, err := util.Multiread(tasks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, breakdown := range breakdowns {
+		breakdown.LiquidAssets = liquidAssets[i].(*big.Int)
+		breakdown.Principal = principals[i].(*big.Int)
+		breakdown.Equity = new(big.Int).Add(breakdown.MinerBalance, breakdown.LiquidAssets)
+		breakdown.Equity.Sub(breakdown.Equity, breakdown.Principal)
+	}
+
+	return breakdowns, miners, nil
+}
+
+func createAgentPrincipalTask(ctx context.Context, q PoolQuerier, agentAddr common.Address, blockNumber *big.Int) util.TaskFunc {
+	return func() (interface{}, error) {
+		return q.AgentPrincipal(ctx, agentAddr, blockNumber)
+	}
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+func TestAgents(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	agents, err := Agents(ctx, env.pool, env.lapi, env.agents, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(agents) != 3 {
+		t.Fatalf("expected 3 agents, got %d", len(agents))
+	}
+
+	agent := agents[0]
+	if agent.ID != 1 || agent.Address != env.fixture.Agents[0].Address {
+		t.Fatalf("unexpected first agent %d %s", agent.ID, agent.Address)
+	}
+	if len(agent.Miners) != 2 || agent.Miners[0].String() != "f01000" || agent.Miners[1].String() != "f01001" {
+		t.Fatalf("unexpected miners %v", agent.Miners)
+	}
+	assertBigInt(t, "MinerBalance", agent.MinerBalance, fil("1500"))
+	assertBigInt(t, "LiquidAssets", agent.LiquidAssets, fil("10"))
+	assertBigInt(t, "Principal", agent.Principal, fil("1000"))
+	assertBigInt(t, "QAP", agent.QAP, big.NewInt(16888498602639360))
+	assertBigInt(t, "RBP", agent.RBP, big.NewInt(6755399441055744))
+	assertBigInt(t, "Equity", agent.Equity, fil("510"))
+
+	assertBigInt(t, "Equity", agents[1].Equity, fil("505"))
+
+	// an agent without principal owns all of its collateral
+	unborrowed := agents[2]
+	if len(unborrowed.Miners) != 1 || unborrowed.Miners[0].String() != "f01003" {
+		t.Fatalf("unexpected miners %v", unborrowed.Miners)
+	}
+	assertBigInt(t, "MinerBalance", unborrowed.MinerBalance, fil("50"))
+	assertBigInt(t, "Equity", unborrowed.Equity, fil("50"))
+}
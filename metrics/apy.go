@@ -2,17 +2,83 @@ package metrics
 
 import (
 	"context"
+	"errors"
+	"math"
 	"math/big"
 
-	pooltypes "github.com/glifio/go-pools/types"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/filecoin-project/go-state-types/builtin"
 	"github.com/glifio/go-pools/util"
 )
 
-func Apy(ctx context.Context, sdk pooltypes.PoolsSDK, blockNumber *big.Int) (*big.Float, error) {
-	apy, err := sdk.Query().InfPoolApy(ctx, blockNumber)
+// RealizedApyWindows are the trailing windows, in days, realized APYs are computed over
+var RealizedApyWindows = []int64{7, 30, 90}
+
+// RealizedApy is the yield iFIL holders actually earned over a trailing window, annualized with compounding
+type RealizedApy struct {
+	Days int64 `json:"days"`
+	// the start of the window
+	Height *big.Int `json:"height"`
+	// 0.1 is 10%, nil when the iFIL rate was zero at the start of the window
+	Apy *big.Float `json:"apy"`
+}
+
+func Apy(ctx context.Context, q PoolQuerier, blockNumber *big.Int) (*big.Float, error) {
+	apy, err := q.InfPoolApy(ctx, blockNumber)
 	if err != nil {
 		return nil, err
 	}
 
 	return util.ToFIL(apy), nil
 }
+
+// RealizedApys computes the APY realized over each of RealizedApyWindows from the change in the iFIL rate.
+// Windows reaching back before genesis, or before the pool was deployed, are skipped.
+func RealizedApys(ctx context.Context, q PoolQuerier, lapi LotusAPI, blockNumber *big.Int) ([]*RealizedApy, error) {
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	blockNumber = tipSetBlockNumber(ts)
+
+	rate, err := IFILRateAt(ctx, q, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	apys := []*RealizedApy{}
+	for _, days := range RealizedApyWindows {
+		height := new(big.Int).Sub(blockNumber, big.NewInt(days*builtin.EpochsInDay))
+		if height.Sign() < 0 {
+			continue
+		}
+
+		prevRate, err := IFILRateAt(ctx, q, height)
+		// the pool's contracts have no code before they are deployed
+		if errors.Is(err, bind.ErrNoCode) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		apys = append(apys, &RealizedApy{
+			Days:   days,
+			Height: height,
+			Apy:    annualize(rateChange(prevRate, rate), days),
+		})
+	}
+
+	return apys, nil
+}
+
+// annualize compounds a change over days into a yearly change. The growth is exact, but raising it to
+// the fractional power 365/days is done in float64, so the result is approximate.
+func annualize(change *big.Rat, days int64) *big.Float {
+	if change == nil {
+		return nil
+	}
+
+	growth, _ := new(big.Rat).Add(big.NewRat(1, 1), change).Float64()
+	return big.NewFloat(math.Pow(growth, 365/float64(days)) - 1)
+}
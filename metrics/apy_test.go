@@ -2,27 +2,73 @@ package metrics
 
 import (
 	"context"
+	"math"
 	"math/big"
 	"testing"
 
-	"github.com/glifio/go-pools/constants"
-	psdk "github.com/glifio/go-pools/sdk"
-	"github.com/glifio/pools-metrics/common"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/glifio/pools-metrics/metrics/metricstest"
 )
 
 func TestApy(t *testing.T) {
 	ctx := context.Background()
 
-	chainID := big.NewInt(constants.MainnetChainID)
-	extern, err := common.GetExtern(chainID)
+	fixture, err := metricstest.LoadFixture("testdata/fixture.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apy, err := Apy(ctx, metricstest.NewPool(fixture), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if apy.Cmp(big.NewFloat(0.125)) != 0 {
+		t.Fatalf("apy: got %v, want 0.125", apy)
+	}
+}
+
+func TestRealizedApys(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	apys, err := RealizedApys(ctx, env.pool, env.lapi, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(apys) != 3 {
+		t.Fatalf("expected 3 realized apys, got %d", len(apys))
+	}
+
+	// the iFIL rate grew from 1.1 to 10/9 over the last 7 days, and from 1 over the last 90 days
+	expected := map[int64]float64{
+		7:  math.Pow(100.0/99, 365.0/7) - 1,
+		30: math.Pow(20.0/19, 365.0/30) - 1,
+		90: math.Pow(10.0/9, 365.0/90) - 1,
+	}
+	for _, apy := range apys {
+		got, _ := apy.Apy.Float64()
+		if math.Abs(got-expected[apy.Days]) > 1e-9 {
+			t.Fatalf("%d day apy: got %v, want %v", apy.Days, got, expected[apy.Days])
+		}
+	}
+	assertBigInt(t, "Height", apys[2].Height, big.NewInt(env.fixture.Head-1-90*builtin.EpochsInDay))
+}
+
+func TestRealizedApysBeforeDeployment(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	// the pool was deployed 60 days before the head, after the start of the 90 day window
+	env.fixture.Pool.DeployedAt = env.fixture.Head - 1 - 60*builtin.EpochsInDay
 
-	sdk, err := psdk.New(ctx, chainID, extern)
-	apy, err := Apy(ctx, sdk, nil)
+	apys, err := RealizedApys(ctx, env.pool, env.lapi, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if apy.Cmp(big.NewFloat(0)) != 1 {
-		t.Fatal("apy should be greater than 0")
+	if len(apys) != 2 || apys[0].Days != 7 || apys[1].Days != 30 {
+		t.Fatalf("expected the 7 and 30 day apys, got %d apys", len(apys))
 	}
 }
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/go-pools/constants"
+	"github.com/glifio/go-pools/vc"
+)
+
+// BorrowQuoteData projects what borrowing Amount against a miner costs over TermDays, and the leverage of the
+// miner's agent afterwards, counting its principal, liquid assets and every miner pledged to it. The borrowed
+// FIL is assumed to stay on the miner, adding to its collateral. A miner not pledged to any agent is quoted as
+// a new agent holding only that miner.
+type BorrowQuoteData struct {
+	Miner address.Address
+	// the agent the miner is pledged to, zero when it is not pledged
+	AgentID  uint64
+	Amount   *big.Int
+	TermDays int64
+	// per-epoch WAD rate of the agent once it holds Amount in additional principal
+	Rate          *big.Int
+	DailyInterest *big.Int
+	// simple interest on Amount over the whole term
+	TotalInterest *big.Int
+	// the agent's borrow cap on its total principal before borrowing
+	MaxBorrow *big.Int
+	// FIL the agent can borrow on top of its principal before borrowing, Amount exceeds the cap when it is above it
+	RemainingCapacity *big.Int
+	ExceedsMaxBorrow  bool
+	// leverage of the agent after borrowing Amount
+	Principal  *big.Int
+	Collateral *big.Int
+	Equity     *big.Int
+	// principal / collateral
+	LTV *big.Rat
+	// principal / equity, nil when the agent's equity is not positive
+	DTE *big.Rat
+
+	Height    *big.Int
+	TipSetKey types.TipSetKey
+	Timestamp uint64
+}
+
+// BorrowQuote quotes borrowing amount against a miner for termDays, with every input evaluated at blockNumber
+func BorrowQuote(ctx context.Context, q PoolRateQuerier, lapi LotusAPI, stats MinerStatsAPI, agents AgentLister, miner address.Address, amount *big.Int, termDays int64, blockNumber *big.Int) (*BorrowQuoteData, error) {
+	if amount.Sign() <= 0 {
+		return nil, fmt.Errorf("borrow amount must be positive, got %s", amount)
+	}
+	if termDays <= 0 {
+		return nil, fmt.Errorf("borrow term must be positive, got %d days", termDays)
+	}
+
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	height := tipSetBlockNumber(ts)
+
+	agent, err := minerAgentAt(ctx, q, agents, miner, height)
+	if err != nil {
+		return nil, err
+	}
+
+	// the agent data and remaining capacity before borrowing
+	var agentID uint64
+	var agentData vc.AgentData
+	var remaining *big.Int
+	if agent != nil {
+		info, err := agentInfoAtTipSet(ctx, q, lapi, stats, agent, ts)
+		if err != nil {
+			return nil, err
+		}
+		agentID = agent.ID
+		agentData = *info.AgentData
+		remaining = info.RemainingCapacity
+	} else {
+		info, err := minerInfoAtTipSet(ctx, q, lapi, stats, miner, ts)
+		if err != nil {
+			return nil, err
+		}
+		agentData = *info.Inputs.AgentData
+		remaining = info.MaxBorrow
+	}
+	maxBorrow := new(big.Int).Add(agentData.Principal, remaining)
+
+	// the agent data the pool would price the agent with once the borrow lands
+	principal := new(big.Int).Add(agentData.Principal, amount)
+	collateral := new(big.Int).Add(agentData.AgentValue, amount)
+	agentData.AgentValue = collateral
+	agentData.Principal = principal
+
+	rate, err := q.InfPoolGetRateAt(ctx, &agentData, height)
+	if err != nil {
+		return nil, err
+	}
+
+	dailyInterest := new(big.Int).Mul(amount, rate)
+	dailyInterest.Mul(dailyInterest, big.NewInt(builtin.EpochsInDay))
+	dailyInterest.Div(dailyInterest, constants.WAD)
+
+	totalInterest := new(big.Int).Mul(amount, rate)
+	totalInterest.Mul(totalInterest, big.NewInt(builtin.EpochsInDay*termDays))
+	totalInterest.Div(totalInterest, constants.WAD)
+
+	equity := new(big.Int).Sub(collateral, principal)
+
+	return &BorrowQuoteData{
+		Miner:             miner,
+		AgentID:           agentID,
+		Amount:            amount,
+		TermDays:          termDays,
+		Rate:              rate,
+		DailyInterest:     dailyInterest,
+		TotalInterest:     totalInterest,
+		MaxBorrow:         maxBorrow,
+		RemainingCapacity: remaining,
+		ExceedsMaxBorrow:  amount.Cmp(remaining) > 0,
+		Principal:         principal,
+		Collateral:        collateral,
+		Equity:            equity,
+		LTV:               ltv(principal, collateral),
+		DTE:               dte(principal, equity),
+		Height:            height,
+		TipSetKey:         ts.Key(),
+		Timestamp:         ts.MinTimestamp(),
+	}, nil
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/glifio/pools-metrics/metrics/metricstest"
+)
+
+// premiumRate is the fixture's current rate plus the fake pool's premium for an agent owing principal FIL against value FIL
+func premiumRate(principal int64, value int64) *big.Int {
+	rate := big.NewInt(95129375951)
+	premium := new(big.Int).Mul(rate, big.NewInt(principal))
+	return rate.Add(rate, premium.Div(premium, big.NewInt(value)))
+}
+
+func TestBorrowQuote(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	miner, err := address.NewFromString("f01000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quote, err := BorrowQuote(ctx, env.pool, env.lapi, env.stats, env.agents, miner, fil("10"), 365, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// f01000 is pledged to agent 1, which owes 1000 FIL against 1510 FIL across f01000, f01001 and its liquid assets
+	if quote.AgentID != 1 {
+		t.Fatalf("expected the quote for agent 1, got %d", quote.AgentID)
+	}
+	assertBigInt(t, "Principal", quote.Principal, fil("1010"))
+	assertBigInt(t, "Collateral", quote.Collateral, fil("1520"))
+	assertBigInt(t, "Equity", quote.Equity, fil("510"))
+	assertRat(t, "LTV", quote.LTV, big.NewRat(101, 152))
+	assertRat(t, "DTE", quote.DTE, big.NewRat(101, 51))
+
+	// the rate is priced with the borrow included, above the agent's rate before borrowing
+	rate := premiumRate(1010, 1520)
+	assertBigInt(t, "Rate", quote.Rate, rate)
+	if quote.Rate.Cmp(premiumRate(1000, 1510)) <= 0 {
+		t.Fatalf("expected the rate to rise with the borrow, got %s", quote.Rate)
+	}
+
+	// 10 FIL * rate * 2880 epochs, and 365 days of it
+	dailyInterest := new(big.Int).Mul(fil("10"), rate)
+	dailyInterest.Mul(dailyInterest, big.NewInt(2880))
+	assertBigInt(t, "DailyInterest", quote.DailyInterest, dailyInterest.Div(dailyInterest, metricstest.WAD))
+	totalInterest := new(big.Int).Mul(fil("10"), rate)
+	totalInterest.Mul(totalInterest, big.NewInt(2880*365))
+	assertBigInt(t, "TotalInterest", quote.TotalInterest, totalInterest.Div(totalInterest, metricstest.WAD))
+
+	// twice the 510 FIL of equity caps the agent's principal at 1020 FIL, 20 FIL above what it owes
+	assertBigInt(t, "MaxBorrow", quote.MaxBorrow, fil("1020"))
+	assertBigInt(t, "RemainingCapacity", quote.RemainingCapacity, fil("20"))
+	if quote.ExceedsMaxBorrow {
+		t.Fatal("10 FIL should not exceed the remaining capacity")
+	}
+	assertBigInt(t, "Height", quote.Height, big.NewInt(env.fixture.Head-1))
+}
+
+func TestBorrowQuoteExceedsMaxBorrow(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	miner, err := address.NewFromString("f01001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// on its own f01001 could borrow 1000 FIL, but agent 1 only has 20 FIL of capacity left
+	quote, err := BorrowQuote(ctx, env.pool, env.lapi, env.stats, env.agents, miner, fil("100"), 30, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !quote.ExceedsMaxBorrow {
+		t.Fatalf("100 FIL should exceed the remaining capacity of %s", quote.RemainingCapacity)
+	}
+
+	if _, err := BorrowQuote(ctx, env.pool, env.lapi, env.stats, env.agents, miner, big.NewInt(0), 30, nil); err == nil {
+		t.Fatal("expected an error for a zero borrow amount")
+	}
+	if _, err := BorrowQuote(ctx, env.pool, env.lapi, env.stats, env.agents, miner, fil("1"), 0, nil); err == nil {
+		t.Fatal("expected an error for a zero borrow term")
+	}
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+	"sort"
+)
+
+// ConcentrationData measures how dependent the pool is on its largest agents and miners
+type ConcentrationData struct {
+	AgentPrincipal  *Concentration `json:"agentPrincipal"`
+	AgentCollateral *Concentration `json:"agentCollateral"`
+	AgentQAP        *Concentration `json:"agentQap"`
+	MinerCollateral *Concentration `json:"minerCollateral"`
+	MinerQAP        *Concentration `json:"minerQap"`
+}
+
+// Concentration is the concentration of a quantity across holders.
+// HHI is the Herfindahl-Hirschman index as the sum of squared shares, ranging from 1/n
+// when n holders hold equal shares to 1 when a single holder holds everything.
+type Concentration struct {
+	HHI   *big.Rat `json:"hhi"`
+	Top1  *big.Rat `json:"top1"`
+	Top5  *big.Rat `json:"top5"`
+	Top10 *big.Rat `json:"top10"`
+}
+
+// Concentrations computes the concentration of principal, collateral and power across agents and miners at blockNumber.
+// An agent's collateral is its miner balances plus its liquid assets, a miner's collateral is its balance.
+func Concentrations(ctx context.Context, q PoolQuerier, lapi LotusAPI, agents AgentLister, blockNumber *big.Int) (*ConcentrationData, error) {
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdowns, miners, err := agentBreakdownsAt(ctx, q, lapi, agents, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	agentPrincipal := make([]*big.Int, len(breakdowns))
+	agentCollateral := make([]*big.Int, len(breakdowns))
+	agentQAP := make([]*big.Int, len(breakdowns))
+	for i, agent := range breakdowns {
+		agentPrincipal[i] = agent.Principal
+		agentCollateral[i] = new(big.Int).Add(agent.MinerBalance, agent.LiquidAssets)
+		agentQAP[i] = agent.QAP
+	}
+
+	minerCollateral := make([]*big.Int, len(miners))
+	minerQAP := make([]*big.Int, len(miners))
+	for i, miner := range miners {
+		minerCollateral[i] = miner.balance
+		minerQAP[i] = miner.power.qap
+	}
+
+	return &ConcentrationData{
+		AgentPrincipal:  concentration(agentPrincipal),
+		AgentCollateral: concentration(agentCollateral),
+		AgentQAP:        concentration(agentQAP),
+		MinerCollateral: concentration(minerCollateral),
+		MinerQAP:        concentration(minerQAP),
+	}, nil
+}
+
+// concentration returns the HHI and top holder shares of vals, which must not be negative
+func concentration(vals []*big.Int) *Concentration {
+	sorted := make([]*big.Int, len(vals))
+	copy(sorted, vals)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Cmp(sorted[j]) > 0
+	})
+
+	total := big.NewInt(0)
+	for _, val := range sorted {
+		total.Add(total, val)
+	}
+
+	// the HHI is sum(val^2) / total^2
+	squares := big.NewInt(0)
+	for _, val := range sorted {
+		squares.Add(squares, new(big.Int).Mul(val, val))
+	}
+
+	return &Concentration{
+		HHI:   ratio(squares, new(big.Int).Mul(total, total)),
+		Top1:  ratio(sumTop(sorted, 1), total),
+		Top5:  ratio(sumTop(sorted, 5), total),
+		Top10: ratio(sumTop(sorted, 10), total),
+	}
+}
+
+// sumTop sums the first n values of sorted
+func sumTop(sorted []*big.Int, n int) *big.Int {
+	sum := big.NewInt(0)
+	for i := 0; i < n && i < len(sorted); i++ {
+		sum.Add(sum, sorted[i])
+	}
+	return sum
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+func TestConcentrations(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	data, err := Concentrations(ctx, env.pool, env.lapi, env.agents, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// agents owe 1000, 2000 and 0 FIL
+	assertRat(t, "AgentPrincipal.HHI", data.AgentPrincipal.HHI, big.NewRat(5, 9))
+	assertRat(t, "AgentPrincipal.Top1", data.AgentPrincipal.Top1, big.NewRat(2, 3))
+	assertRat(t, "AgentPrincipal.Top5", data.AgentPrincipal.Top5, big.NewRat(1, 1))
+
+	// miners hold 1000, 500, 2500 and 50 FIL
+	assertRat(t, "MinerCollateral.HHI", data.MinerCollateral.HHI, big.NewRat(3001, 6561))
+	assertRat(t, "MinerCollateral.Top1", data.MinerCollateral.Top1, big.NewRat(50, 81))
+
+	// miners hold 10, 5 and 20 PiB, and 1 TiB
+	assertRat(t, "MinerQAP.Top1", data.MinerQAP.Top1, big.NewRat(20*1024, 35*1024+1))
+	assertRat(t, "AgentQAP.Top1", data.AgentQAP.Top1, big.NewRat(20*1024, 35*1024+1))
+}
+
+func TestConcentrationEmpty(t *testing.T) {
+	c := concentration(nil)
+	assertRat(t, "HHI", c.HHI, new(big.Rat))
+	assertRat(t, "Top10", c.Top10, new(big.Rat))
+}
@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/actors/builtin"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/reward"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/go-pools/util"
+)
+
+// a faulty sector is charged a continued fault fee of 3.51 days of the block rewards its power is expected to earn every day
+var (
+	continuedFaultFactorNum   = big.NewInt(351)
+	continuedFaultFactorDenom = big.NewInt(100)
+)
+
+// FaultData is the fault state of the pledged miners
+type FaultData struct {
+	FaultySectors *big.Int `json:"faultySectors"`
+	FaultyRBP     *big.Int `json:"faultyRBP"`
+	FaultyQAP     *big.Int `json:"faultyQAP"`
+	FaultyMiners  uint64   `json:"faultyMiners"`
+	// estimated fault fees charged per day across every faulty miner
+	DailyFaultPenalty *big.Int `json:"dailyFaultPenalty"`
+	// the pledged miners with active faults
+	Miners []*MinerFaults `json:"miners"`
+}
+
+// MinerFaults is the fault state of a single miner
+type MinerFaults struct {
+	Miner             address.Address `json:"miner"`
+	AgentID           uint64          `json:"agentId"`
+	LiveSectors       *big.Int        `json:"liveSectors"`
+	FaultySectors     *big.Int        `json:"faultySectors"`
+	RecoveringSectors *big.Int        `json:"recoveringSectors"`
+	FaultyRBP         *big.Int        `json:"faultyRBP"`
+	// summed quality adjusted power of the faulty sectors
+	FaultyQAP            *big.Int `json:"faultyQAP"`
+	ExpectedDailyRewards *big.Int `json:"expectedDailyRewards"`
+	// estimated from the network's block reward per unit of quality adjusted power
+	DailyFaultPenalty *big.Int `json:"dailyFaultPenalty"`
+}
+
+// Faults reports the faulty sectors and power of every pledged miner at blockNumber, along with the fault fees they are expected to pay
+func Faults(ctx context.Context, q PoolQuerier, lapi LotusAPI, stats MinerStatsAPI, blockNumber *big.Int) (*FaultData, error) {
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	_, miners, err := pledgedMinersAt(ctx, q, lapi, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	networkQAP, _, err := networkPowerAt(ctx, lapi, ts.Key())
+	if err != nil {
+		return nil, err
+	}
+
+	epochReward, err := thisEpochRewardAt(ctx, lapi, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	var faulty []*pledgedMiner
+	for _, miner := range miners {
+		if miner.power.faulty.Sign() > 0 {
+			faulty = append(faulty, miner)
+		}
+	}
+
+	tasks := make([]util.TaskFunc, len(faulty))
+	for i, miner := range faulty {
+		tasks[i] = createMinerFaultsTask(ctx, lapi, stats, miner, epochReward, networkQAP, ts)
+	}
+
+	results, err := util.Multiread(tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &FaultData{
+		FaultySectors:     big.NewInt(0),
+		FaultyRBP:         big.NewInt(0),
+		FaultyQAP:         big.NewInt(0),
+		FaultyMiners:      uint64(len(faulty)),
+		DailyFaultPenalty: big.NewInt(0),
+		Miners:            make([]*MinerFaults, len(results)),
+	}
+	for i, result := range results {
+		faults := result.(*MinerFaults)
+		data.Miners[i] = faults
+		data.FaultySectors.Add(data.FaultySectors, faults.FaultySectors)
+		data.FaultyRBP.Add(data.FaultyRBP, faults.FaultyRBP)
+		data.FaultyQAP.Add(data.FaultyQAP, faults.FaultyQAP)
+		data.DailyFaultPenalty.Add(data.DailyFaultPenalty, faults.DailyFaultPenalty)
+	}
+
+	return data, nil
+}
+
+// thisEpochRewardAt returns the block reward paid out by the reward actor at ts
+func thisEpochRewardAt(ctx context.Context, lapi LotusAPI, ts *types.TipSet) (*big.Int, error) {
+	actor, err := lapi.StateReadState(ctx, reward.Address, ts.Key())
+	if err != nil {
+		return nil, err
+	}
+
+	// the actor state comes back as generic JSON, decode the one field read here
+	raw, err := json.Marshal(actor.State)
+	if err != nil {
+		return nil, err
+	}
+	var state struct {
+		ThisEpochReward types.BigInt
+	}
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, err
+	}
+	if state.ThisEpochReward.Int == nil {
+		return nil, fmt.Errorf("reward actor state at height %d has no ThisEpochReward", ts.Height())
+	}
+
+	return state.ThisEpochReward.Int, nil
+}
+
+func createMinerFaultsTask(ctx context.Context, lapi LotusAPI, stats MinerStatsAPI, miner *pledgedMiner, epochReward *big.Int, networkQAP *big.Int, ts *types.TipSet) util.TaskFunc {
+	return func() (interface{}, error) {
+		info, err := lapi.StateMinerInfo(ctx, miner.miner, ts.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		edr, err := stats.ExpectedDailyRewards(ctx, miner.miner, ts)
+		if err != nil {
+			return nil, err
+		}
+
+		faults, err := lapi.StateMinerFaults(ctx, miner.miner, ts.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		sectors, err := lapi.StateMinerSectors(ctx, miner.miner, &faults, ts.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		pow := miner.power
+		faultyRBP := new(big.Int).Mul(pow.faulty, new(big.Int).SetUint64(uint64(info.SectorSize)))
+
+		// faulty sectors drop out of the miner's power claim, so their power comes from their own deal weights
+		faultyQAP := big.NewInt(0)
+		for _, sector := range sectors {
+			qap := builtin.QAPowerForWeight(info.SectorSize, sector.Expiration-sector.Activation, sector.DealWeight, sector.VerifiedDealWeight)
+			faultyQAP.Add(faultyQAP, qap.Int)
+		}
+
+		// the network pays epochReward across networkQAP every epoch, charge the faulty power 3.51 days of its share
+		penalty := big.NewInt(0)
+		if networkQAP.Sign() > 0 {
+			penalty.Mul(faultyQAP, epochReward)
+			penalty.Mul(penalty, big.NewInt(builtin.EpochsInDay))
+			penalty.Mul(penalty, continuedFaultFactorNum)
+			penalty.Div(penalty, new(big.Int).Mul(networkQAP, continuedFaultFactorDenom))
+		}
+
+		return &MinerFaults{
+			Miner:                miner.miner,
+			AgentID:              miner.agentID,
+			LiveSectors:          pow.sectors,
+			FaultySectors:        pow.faulty,
+			RecoveringSectors:    pow.recovering,
+			FaultyRBP:            faultyRBP,
+			FaultyQAP:            faultyQAP,
+			ExpectedDailyRewards: edr,
+			DailyFaultPenalty:    penalty,
+		}, nil
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/metrics/metricstest"
+)
+
+func TestFaults(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	data, err := Faults(ctx, env.pool, env.lapi, env.stats, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sectorSize := big.NewInt(32 << 30)
+	sectors := func(n int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(n), sectorSize)
+	}
+
+	// f01000 has 10 faulty sectors, 5 of them at 10x quality, and f01002 has 50 at 10x quality
+	if data.FaultyMiners != 2 || len(data.Miners) != 2 {
+		t.Fatalf("expected 2 faulty miners, got %d", data.FaultyMiners)
+	}
+	assertBigInt(t, "FaultySectors", data.FaultySectors, big.NewInt(60))
+	assertBigInt(t, "FaultyRBP", data.FaultyRBP, sectors(60))
+	assertBigInt(t, "FaultyQAP", data.FaultyQAP, sectors(555))
+
+	first := faultPenalty(env, sectors(55))
+	second := faultPenalty(env, sectors(500))
+
+	miner := data.Miners[0]
+	if miner.Miner.String() != "f01000" || miner.AgentID != 1 {
+		t.Fatalf("unexpected miner %s of agent %d", miner.Miner, miner.AgentID)
+	}
+	assertBigInt(t, "RecoveringSectors", miner.RecoveringSectors, big.NewInt(4))
+	assertBigInt(t, "FaultyQAP", miner.FaultyQAP, sectors(55))
+	assertBigInt(t, "DailyFaultPenalty", miner.DailyFaultPenalty, first)
+	assertBigInt(t, "DailyFaultPenalty", data.DailyFaultPenalty, new(big.Int).Add(first, second))
+}
+
+func TestFaultsAllSectorsFaulty(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	// every sector of f01001 is faulty, leaving it without any power claim
+	miner := env.fixture.Miners["f01001"]
+	miner.Sectors = metricstest.SectorsFixture{Live: 500, Faulty: 500}
+	miner.QAP = types.NewInt(0)
+	miner.RBP = types.NewInt(0)
+
+	data, err := Faults(ctx, env.pool, env.lapi, env.stats, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data.FaultyMiners != 3 || data.Miners[1].Miner.String() != "f01001" {
+		t.Fatalf("expected f01001 among 3 faulty miners, got %d", data.FaultyMiners)
+	}
+	faults := data.Miners[1]
+	sectors := new(big.Int).Mul(big.NewInt(500), big.NewInt(32<<30))
+	assertBigInt(t, "FaultyQAP", faults.FaultyQAP, sectors)
+	assertBigInt(t, "DailyFaultPenalty", faults.DailyFaultPenalty, faultPenalty(env, sectors))
+}
+
+// faultPenalty is 3.51 days of the block rewards the network pays per unit of faultyQAP
+func faultPenalty(env *testEnv, faultyQAP *big.Int) *big.Int {
+	p := new(big.Int).Mul(faultyQAP, env.fixture.ThisEpochReward.Int)
+	p.Mul(p, big.NewInt(builtin.EpochsInDay*351))
+	return p.Div(p, new(big.Int).Mul(env.fixture.NetworkQAP.Int, big.NewInt(100)))
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/glifio/go-pools/util"
+)
+
+// IFILRateLookbacks are the number of epochs before the requested height the iFIL rate is compared against
+var IFILRateLookbacks = []int64{builtin.EpochsInDay, 7 * builtin.EpochsInDay, 30 * builtin.EpochsInDay}
+
+// IFILData is the iFIL liquid staking token's supply and FIL conversion rate
+type IFILData struct {
+	TotalSupply *big.Int `json:"totalSupply"`
+	TotalAssets *big.Int `json:"totalAssets"`
+	// FIL redeemable per iFIL
+	Rate    *big.Rat          `json:"rate"`
+	Changes []*IFILRateChange `json:"changes"`
+	Height  *big.Int          `json:"height"`
+}
+
+// IFILRateChange compares the iFIL rate against its value Epochs earlier
+type IFILRateChange struct {
+	Epochs int64    `json:"epochs"`
+	Height *big.Int `json:"height"`
+	Rate   *big.Rat `json:"rate"`
+	// relative change of the rate since Height, 0.01 is 1%. nil when the rate was zero at Height
+	Change *big.Rat `json:"change"`
+}
+
+// IFIL returns the iFIL supply and conversion rate at blockNumber, and how the rate changed over IFILRateLookbacks
+func IFIL(ctx context.Context, q PoolQuerier, lapi LotusAPI, blockNumber *big.Int) (*IFILData, error) {
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	blockNumber = tipSetBlockNumber(ts)
+
+	supply, assets, err := ifilSupplyAt(ctx, q, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	rate := ifilRate(assets, supply)
+
+	data := &IFILData{
+		TotalSupply: supply,
+		TotalAssets: assets,
+		Rate:        rate,
+		Changes:     []*IFILRateChange{},
+		Height:      blockNumber,
+	}
+
+	for _, epochs := range IFILRateLookbacks {
+		height := new(big.Int).Sub(blockNumber, big.NewInt(epochs))
+		if height.Sign() < 0 {
+			continue
+		}
+
+		prevRate, err := IFILRateAt(ctx, q, height)
+		if err != nil {
+			return nil, err
+		}
+
+		data.Changes = append(data.Changes, &IFILRateChange{
+			Epochs: epochs,
+			Height: height,
+			Rate:   prevRate,
+			Change: rateChange(prevRate, rate),
+		})
+	}
+
+	return data, nil
+}
+
+// IFILRateAt returns the FIL redeemable per iFIL at blockNumber
+func IFILRateAt(ctx context.Context, q PoolQuerier, blockNumber *big.Int) (*big.Rat, error) {
+	supply, assets, err := ifilSupplyAt(ctx, q, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return ifilRate(assets, supply), nil
+}
+
+func ifilSupplyAt(ctx context.Context, q PoolQuerier, blockNumber *big.Int) (supply *big.Int, assets *big.Int, err error) {
+	supplyFloat, err := q.IFILTotalSupply(ctx, blockNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	assetsFloat, err := q.InfPoolTotalAssets(ctx, blockNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return util.ToAtto(supplyFloat), util.ToAtto(assetsFloat), nil
+}
+
+// ifilRate returns assets per iFIL, iFIL converts 1:1 while none is minted
+func ifilRate(assets *big.Int, supply *big.Int) *big.Rat {
+	if supply.Sign() == 0 {
+		return big.NewRat(1, 1)
+	}
+	return new(big.Rat).SetFrac(assets, supply)
+}
+
+// rateChange returns the relative change from prev to cur, or nil when prev is zero
+func rateChange(prev *big.Rat, cur *big.Rat) *big.Rat {
+	if prev.Sign() == 0 {
+		return nil
+	}
+	change := new(big.Rat).Quo(cur, prev)
+	return change.Sub(change, big.NewRat(1, 1))
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/builtin"
+)
+
+func TestIFIL(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	data, err := IFIL(ctx, env.pool, env.lapi, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertBigInt(t, "TotalSupply", data.TotalSupply, fil("1800000"))
+	assertBigInt(t, "TotalAssets", data.TotalAssets, fil("2000000"))
+	assertRat(t, "Rate", data.Rate, big.NewRat(10, 9))
+	assertBigInt(t, "Height", data.Height, big.NewInt(env.fixture.Head-1))
+
+	if len(data.Changes) != 3 {
+		t.Fatalf("expected 3 rate changes, got %d", len(data.Changes))
+	}
+
+	day := data.Changes[0]
+	if day.Epochs != builtin.EpochsInDay {
+		t.Fatalf("expected a 1 day lookback first, got %d epochs", day.Epochs)
+	}
+	assertBigInt(t, "Height", day.Height, big.NewInt(env.fixture.Head-1-builtin.EpochsInDay))
+	assertRat(t, "Rate", day.Rate, big.NewRat(1998, 1800))
+	// 2000000 / 1998000 - 1
+	assertRat(t, "Change", day.Change, big.NewRat(1, 999))
+
+	// 30 days earlier, the rate was 19/18
+	assertRat(t, "Rate", data.Changes[2].Rate, big.NewRat(19, 18))
+	assertRat(t, "Change", data.Changes[2].Change, big.NewRat(1, 19))
+}
+
+func TestIFILRateWithoutSupply(t *testing.T) {
+	assertRat(t, "rate", ifilRate(big.NewInt(0), big.NewInt(0)), big.NewRat(1, 1))
+}
@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// LeverageData is the pool's leverage in aggregate and by agent.
+// Collateral is an agent's miner balances plus liquid assets, and equity is collateral minus principal.
+type LeverageData struct {
+	Principal  *big.Int `json:"principal"`
+	Collateral *big.Int `json:"collateral"`
+	Equity     *big.Int `json:"equity"`
+	// principal / collateral, nil when the pool owes principal without any collateral
+	LTV *big.Rat `json:"ltv"`
+	// principal / equity, nil when the pool's equity is not positive
+	DTE *big.Rat `json:"dte"`
+	// distributions over agents with outstanding principal
+	AgentLTV *Distribution `json:"agentLtv"`
+	AgentDTE *Distribution `json:"agentDte"`
+	// agents whose principal is not covered by their collateral, excluded from the DTE distribution,
+	// and from the LTV distribution as well when they have no collateral at all
+	InsolventAgents uint64           `json:"insolventAgents"`
+	Agents          []*AgentLeverage `json:"agents"`
+}
+
+// AgentLeverage is the leverage of a single agent
+type AgentLeverage struct {
+	ID         uint64         `json:"id"`
+	Address    common.Address `json:"address"`
+	Principal  *big.Int       `json:"principal"`
+	Collateral *big.Int       `json:"collateral"`
+	Equity     *big.Int       `json:"equity"`
+	// nil when the agent owes principal without any collateral
+	LTV *big.Rat `json:"ltv"`
+	DTE *big.Rat `json:"dte"`
+}
+
+// Distribution summarizes a set of ratios
+type Distribution struct {
+	Count  uint64   `json:"count"`
+	Median *big.Rat `json:"median"`
+	P90    *big.Rat `json:"p90"`
+	Max    *big.Rat `json:"max"`
+}
+
+// Leverage computes the loan-to-value and debt-to-equity ratios of the pool and its agents at blockNumber
+func Leverage(ctx context.Context, q PoolQuerier, lapi LotusAPI, agents AgentLister, blockNumber *big.Int) (*LeverageData, error) {
+	breakdowns, err := Agents(ctx, q, lapi, agents, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return leverageFromAgents(breakdowns), nil
+}
+
+func leverageFromAgents(breakdowns []*AgentBreakdown) *LeverageData {
+	data := &LeverageData{
+		Principal:  big.NewInt(0),
+		Collateral: big.NewInt(0),
+		Agents:     make([]*AgentLeverage, len(breakdowns)),
+	}
+
+	var ltvs, dtes []*big.Rat
+	for i, agent := range breakdowns {
+		collateral := new(big.Int).Add(agent.MinerBalance, agent.LiquidAssets)
+		leverage := &AgentLeverage{
+			ID:         agent.ID,
+			Address:    agent.Address,
+			Principal:  agent.Principal,
+			Collateral: collateral,
+			Equity:     agent.Equity,
+			LTV:        ltv(agent.Principal, collateral),
+			DTE:        dte(agent.Principal, agent.Equity),
+		}
+		data.Agents[i] = leverage
+		data.Principal.Add(data.Principal, agent.Principal)
+		data.Collateral.Add(data.Collateral, collateral)
+
+		if agent.Principal.Sign() == 0 {
+			continue
+		}
+		if leverage.LTV != nil {
+			ltvs = append(ltvs, leverage.LTV)
+		}
+		if leverage.DTE == nil {
+			data.InsolventAgents++
+			continue
+		}
+		dtes = append(dtes, leverage.DTE)
+	}
+
+	data.Equity = new(big.Int).Sub(data.Collateral, data.Principal)
+	data.LTV = ltv(data.Principal, data.Collateral)
+	data.DTE = dte(data.Principal, data.Equity)
+	data.AgentLTV = distribution(ltvs)
+	data.AgentDTE = distribution(dtes)
+
+	return data
+}
+
+// ltv returns principal/collateral, or nil when principal is owed without positive collateral
+func ltv(principal *big.Int, collateral *big.Int) *big.Rat {
+	if collateral.Sign() <= 0 {
+		if principal.Sign() > 0 {
+			return nil
+		}
+		return new(big.Rat)
+	}
+	return new(big.Rat).SetFrac(principal, collateral)
+}
+
+// dte returns principal/equity, or nil when equity is not positive
+func dte(principal *big.Int, equity *big.Int) *big.Rat {
+	if equity.Sign() <= 0 {
+		return nil
+	}
+	return new(big.Rat).SetFrac(principal, equity)
+}
+
+// distribution returns the median, 90th percentile (nearest rank) and max of vals
+func distribution(vals []*big.Rat) *Distribution {
+	d := &Distribution{
+		Count:  uint64(len(vals)),
+		Median: new(big.Rat),
+		P90:    new(big.Rat),
+		Max:    new(big.Rat),
+	}
+	if len(vals) == 0 {
+		return d
+	}
+
+	sorted := make([]*big.Rat, len(vals))
+	copy(sorted, vals)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Cmp(sorted[j]) < 0
+	})
+
+	n := len(sorted)
+	if n%2 == 1 {
+		d.Median.Set(sorted[n/2])
+	} else {
+		d.Median.Add(sorted[n/2-1], sorted[n/2])
+		d.Median.Quo(d.Median, big.NewRat(2, 1))
+	}
+	// nearest rank: the smallest value at or above 90% of the values
+	d.P90.Set(sorted[(9*n+9)/10-1])
+	d.Max.Set(sorted[n-1])
+
+	return d
+}
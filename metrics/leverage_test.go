@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+func TestLeverage(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	leverage, err := Leverage(ctx, env.pool, env.lapi, env.agents, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertBigInt(t, "Principal", leverage.Principal, fil("3000"))
+	assertBigInt(t, "Collateral", leverage.Collateral, fil("4065"))
+	assertBigInt(t, "Equity", leverage.Equity, fil("1065"))
+	assertRat(t, "LTV", leverage.LTV, big.NewRat(3000, 4065))
+	assertRat(t, "DTE", leverage.DTE, big.NewRat(3000, 1065))
+
+	// agent 1 owes 1000 FIL against 1510 FIL, agent 2 owes 2000 FIL against 2505 FIL
+	assertRat(t, "agent 1 LTV", leverage.Agents[0].LTV, big.NewRat(1000, 1510))
+	assertRat(t, "agent 1 DTE", leverage.Agents[0].DTE, big.NewRat(1000, 510))
+	assertRat(t, "agent 2 DTE", leverage.Agents[1].DTE, big.NewRat(2000, 505))
+
+	// agent 3 has no principal and is left out of the distributions
+	if leverage.AgentLTV.Count != 2 || leverage.AgentDTE.Count != 2 {
+		t.Fatalf("expected 2 agents in the distributions, got %d and %d", leverage.AgentLTV.Count, leverage.AgentDTE.Count)
+	}
+	median := new(big.Rat).Add(big.NewRat(1000, 1510), big.NewRat(2000, 2505))
+	median.Quo(median, big.NewRat(2, 1))
+	assertRat(t, "LTV median", leverage.AgentLTV.Median, median)
+	assertRat(t, "LTV max", leverage.AgentLTV.Max, big.NewRat(2000, 2505))
+	assertRat(t, "DTE p90", leverage.AgentDTE.P90, big.NewRat(2000, 505))
+}
+
+func TestLeverageInsolventAgent(t *testing.T) {
+	leverage := leverageFromAgents([]*AgentBreakdown{{
+		ID:           1,
+		MinerBalance: big.NewInt(50),
+		LiquidAssets: big.NewInt(0),
+		Principal:    big.NewInt(100),
+		Equity:       big.NewInt(-50),
+	}})
+
+	if leverage.DTE != nil || leverage.Agents[0].DTE != nil {
+		t.Fatal("expected no DTE without positive equity")
+	}
+	if leverage.InsolventAgents != 1 || leverage.AgentDTE.Count != 0 {
+		t.Fatalf("expected 1 insolvent agent outside the DTE distribution, got %d", leverage.InsolventAgents)
+	}
+	assertRat(t, "LTV", leverage.LTV, big.NewRat(2, 1))
+}
+
+func TestLeverageZeroCollateralAgent(t *testing.T) {
+	leverage := leverageFromAgents([]*AgentBreakdown{{
+		ID:           1,
+		MinerBalance: big.NewInt(0),
+		LiquidAssets: big.NewInt(0),
+		Principal:    big.NewInt(100),
+		Equity:       big.NewInt(-100),
+	}, {
+		ID:           2,
+		MinerBalance: big.NewInt(400),
+		LiquidAssets: big.NewInt(0),
+		Principal:    big.NewInt(100),
+		Equity:       big.NewInt(300),
+	}})
+
+	if leverage.Agents[0].LTV != nil || leverage.Agents[0].DTE != nil {
+		t.Fatal("expected no LTV or DTE for an agent owing principal without collateral")
+	}
+	if leverage.InsolventAgents != 1 {
+		t.Fatalf("expected 1 insolvent agent, got %d", leverage.InsolventAgents)
+	}
+	// only agent 2 is in the distributions
+	if leverage.AgentLTV.Count != 1 || leverage.AgentDTE.Count != 1 {
+		t.Fatalf("expected 1 agent in the distributions, got %d and %d", leverage.AgentLTV.Count, leverage.AgentDTE.Count)
+	}
+	assertRat(t, "LTV max", leverage.AgentLTV.Max, big.NewRat(1, 4))
+	assertRat(t, "LTV", leverage.LTV, big.NewRat(200, 400))
+
+	// the pool has no LTV either once nothing is pledged against its principal
+	pool := leverageFromAgents([]*AgentBreakdown{{
+		ID:           1,
+		MinerBalance: big.NewInt(0),
+		LiquidAssets: big.NewInt(0),
+		Principal:    big.NewInt(100),
+		Equity:       big.NewInt(-100),
+	}})
+	if pool.LTV != nil || pool.AgentLTV.Count != 0 {
+		t.Fatal("expected no pool LTV and an empty LTV distribution without collateral")
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	var vals []*big.Rat
+	for i := int64(10); i >= 1; i-- {
+		vals = append(vals, big.NewRat(i, 1))
+	}
+
+	d := distribution(vals)
+	assertRat(t, "Median", d.Median, big.NewRat(11, 2))
+	assertRat(t, "P90", d.P90, big.NewRat(9, 1))
+	assertRat(t, "Max", d.Max, big.NewRat(10, 1))
+}
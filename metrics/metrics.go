@@ -2,18 +2,12 @@ package metrics
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"math/big"
-	"net/http"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/filecoin-project/go-address"
-	"github.com/filecoin-project/go-state-types/abi"
-	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/types"
-	pooltypes "github.com/glifio/go-pools/types"
 	"github.com/glifio/go-pools/util"
 )
 
@@ -29,79 +23,109 @@ type MetricData struct {
 	TotalMinersSectors        *big.Int `json:"totalMinersSectors"`
 	TotalMinerQAP             *big.Int `json:"totalMinerQAP"`
 	TotalMinerRBP             *big.Int `json:"totalMinerRBP"`
+
+	// sector totals of pledged miners by state, TotalMinersSectors counts the live sectors
+	TotalActiveSectors     *big.Int `json:"totalActiveSectors"`
+	TotalFaultySectors     *big.Int `json:"totalFaultySectors"`
+	TotalRecoveringSectors *big.Int `json:"totalRecoveringSectors"`
+
+	// network power at the tipset, and the pledged miners' share of it. The network totals only count
+	// miners above the consensus minimum power, so the shares only count the pledged miners above it
+	NetworkQAP *big.Int `json:"networkQAP"`
+	NetworkRBP *big.Int `json:"networkRBP"`
+	QAPShare   *big.Rat `json:"qapShare"`
+	RBPShare   *big.Rat `json:"rbpShare"`
+	// share of block rewards the pledged miners are expected to win, their share of the network's QAP:
+	// only miners above the consensus minimum power are eligible to win blocks
+	BlockRewardShare *big.Rat `json:"blockRewardShare"`
+
+	// pool ratios derived from the balances above, see SetRatios
+	Utilization           *big.Rat `json:"utilization"`
+	BorrowableShare       *big.Rat `json:"borrowableShare"`
+	ExitReserveCoverage   *big.Rat `json:"exitReserveCoverage"`
+	WithdrawableLiquidity *big.Int `json:"withdrawableLiquidity"`
+
+	// the tipset every query was pinned to
+	Height    *big.Int        `json:"height"`
+	TipSetKey types.TipSetKey `json:"tipSetKey"`
+	Timestamp uint64          `json:"timestamp"`
 }
 
-func Metrics(ctx context.Context, sdk pooltypes.PoolsSDK, blockNumber *big.Int) (*MetricData, error) {
-	poolTotalAssetsFloat, err := sdk.Query().InfPoolTotalAssets(ctx, blockNumber)
+func Metrics(ctx context.Context, q PoolQuerier, lapi LotusAPI, agents AgentLister, blockNumber *big.Int) (*MetricData, error) {
+	// resolve the tipset once and pin every query to it, so the metrics are internally consistent
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	blockNumber = tipSetBlockNumber(ts)
+
+	poolTotalAssetsFloat, err := q.InfPoolTotalAssets(ctx, blockNumber)
 	if err != nil {
 		return nil, err
 	}
 	poolTotalAssets := util.ToAtto(poolTotalAssetsFloat)
 
-	poolTotalBorrowable, err := sdk.Query().InfPoolBorrowableLiquidity(ctx, blockNumber)
+	poolTotalBorrowable, err := q.InfPoolBorrowableLiquidity(ctx, blockNumber)
 	if err != nil {
 		return nil, err
 	}
 
-	poolExitReserves, _, err := sdk.Query().InfPoolExitReserve(ctx, blockNumber)
+	poolExitReserves, _, err := q.InfPoolExitReserve(ctx, blockNumber)
 	if err != nil {
 		return nil, err
 	}
 
-	poolTotalBorrowedFloat, err := sdk.Query().InfPoolTotalBorrowed(ctx, blockNumber)
+	poolTotalBorrowedFloat, err := q.InfPoolTotalBorrowed(ctx, blockNumber)
 	if err != nil {
 		return nil, err
 	}
 	poolTotalBorrowed := util.ToAtto(poolTotalBorrowedFloat)
 
-	agentCount, minerCount, totalMinerCollaterals, totalMinerSectors, totalMinerQAP, totalMinerRBP, err := MinerCollaterals(ctx, sdk, blockNumber)
+	totals, err := minerCollateralsAt(ctx, q, lapi, agents, ts)
 	if err != nil {
 		return nil, err
 	}
 
-	tvl := new(big.Int).Add(poolTotalAssets, totalMinerCollaterals)
+	tvl := new(big.Int).Add(poolTotalAssets, totals.collaterals)
 
-	return &MetricData{
+	metrics := &MetricData{
 		PoolTotalAssets:           poolTotalAssets,
 		PoolTotalBorrowed:         poolTotalBorrowed,
 		PoolTotalBorrowableAssets: util.ToAtto(poolTotalBorrowable),
 		PoolExitReserve:           poolExitReserves,
-		TotalAgentCount:           agentCount,
-		TotalMinerCollaterals:     totalMinerCollaterals,
-		TotalMinersCount:          minerCount,
-		TotalMinersSectors:        totalMinerSectors,
-		TotalMinerQAP:             totalMinerQAP,
-		TotalMinerRBP:             totalMinerRBP,
+		TotalAgentCount:           totals.agentCount,
+		TotalMinerCollaterals:     totals.collaterals,
+		TotalMinersCount:          totals.minerCount,
+		TotalMinersSectors:        totals.sectors.sectors,
+		TotalMinerQAP:             totals.sectors.qap,
+		TotalMinerRBP:             totals.sectors.rbp,
 		TotalValueLocked:          tvl,
-	}, nil
-}
-
-func AgentsLiquidAssets(ctx context.Context, sdk pooltypes.PoolsSDK, blockNumber *big.Int) (*big.Int, error) {
-	resp, err := http.Get("https://events.glif.link/agent/list")
-	if err != nil {
-		return nil, err
+		TotalActiveSectors:        totals.sectors.active,
+		TotalFaultySectors:        totals.sectors.faulty,
+		TotalRecoveringSectors:    totals.sectors.recovering,
+		NetworkQAP:                totals.networkQAP,
+		NetworkRBP:                totals.networkRBP,
+		QAPShare:                  ratio(totals.eligibleQAP, totals.networkQAP),
+		RBPShare:                  ratio(totals.eligibleRBP, totals.networkRBP),
+		BlockRewardShare:          ratio(totals.eligibleQAP, totals.networkQAP),
+		Height:                    blockNumber,
+		TipSetKey:                 ts.Key(),
+		Timestamp:                 ts.MinTimestamp(),
 	}
-	defer resp.Body.Close()
+	metrics.SetRatios()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+	return metrics, nil
+}
 
-	var data []struct {
-		TxHash  string         `json:"txHash"`
-		ID      uint64         `json:"id"`
-		Address common.Address `json:"address"`
-		Height  *big.Int       `json:"height"`
-	}
-	err = json.Unmarshal(body, &data)
+func AgentsLiquidAssets(ctx context.Context, q PoolQuerier, agents AgentLister, blockNumber *big.Int) (*big.Int, error) {
+	data, err := agents.ListAgents(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	tasks := make([]util.TaskFunc, len(data))
 	for i, agent := range data {
-		tasks[i] = createAgentLiquidAssetTask(ctx, sdk, agent.Address, blockNumber)
+		tasks[i] = createAgentLiquidAssetTask(ctx, q, agent.Address, blockNumber)
 	}
 
 	agentsLiquidAssets, err := util.Multiread(tasks)
@@ -117,100 +141,166 @@ func AgentsLiquidAssets(ctx context.Context, sdk pooltypes.PoolsSDK, blockNumber
 	return totalAgentLiquidAssets, nil
 }
 
-func MinerCollaterals(ctx context.Context, sdk pooltypes.PoolsSDK, blockNumber *big.Int) (agentCount *big.Int, minerCount *big.Int, minerCollaterals *big.Int, totalMinerSectors *big.Int, totalMinerQAP *big.Int, totalMinerRBP *big.Int, err error) {
-	agentCount, err = sdk.Query().AgentFactoryAgentCount(ctx, blockNumber)
+func MinerCollaterals(ctx context.Context, q PoolQuerier, lapi LotusAPI, agents AgentLister, blockNumber *big.Int) (agentCount *big.Int, minerCount *big.Int, minerCollaterals *big.Int, totalMinerSectors *big.Int, totalMinerQAP *big.Int, totalMinerRBP *big.Int, err error) {
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+
+	totals, err := minerCollateralsAt(ctx, q, lapi, agents, ts)
 	if err != nil {
 		return nil, nil, nil, nil, nil, nil, err
 	}
 
+	return totals.agentCount, totals.minerCount, totals.collaterals, totals.sectors.sectors, totals.sectors.qap, totals.sectors.rbp, nil
+}
+
+// minerTotals aggregates the agents and pledged miners of the pool at a tipset
+type minerTotals struct {
+	agentCount  *big.Int
+	minerCount  *big.Int
+	collaterals *big.Int
+	// summed sectors and power of every pledged miner
+	sectors *MinerSectorsPower
+	// summed power of the pledged miners eligible to win blocks
+	// power of the miners above the consensus minimum power
+	eligibleQAP *big.Int
+	eligibleRBP *big.Int
+	networkQAP  *big.Int
+	networkRBP  *big.Int
+}
+
+// pledgedMiner is a miner pledged to an agent, with its balance and power at a tipset
+type pledgedMiner struct {
+	agentID uint64
+	miner   address.Address
+	balance *big.Int
+	power   *MinerSectorsPower
+}
+
+// pledgedMinersAt enumerates every miner pledged to an agent at ts, along with the agent count
+func pledgedMinersAt(ctx context.Context, q PoolQuerier, lapi LotusAPI, ts *types.TipSet) (*big.Int, []*pledgedMiner, error) {
+	blockNumber := tipSetBlockNumber(ts)
+	tsk := ts.Key()
+
+	agentCount, err := q.AgentFactoryAgentCount(ctx, blockNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// parallelize calls to the miner registry to get the list of every miner pledged in the system
 	tasks := make([]util.TaskFunc, agentCount.Int64())
 	for i := int64(0); i < agentCount.Int64(); i++ {
 		index := big.NewInt(i + 1)
 		tasks[i] = func() (interface{}, error) {
 			// add one to the index because the agent ids start at 1
-			return sdk.Query().MinerRegistryAgentMinersList(ctx, index, blockNumber)
+			return q.MinerRegistryAgentMinersList(ctx, index, blockNumber)
 		}
 	}
 
 	results, err := util.Multiread(tasks)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, nil, err
 	}
 
-	lapi, closer, err := sdk.Extern().ConnectLotusClient()
-	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+	var miners []*pledgedMiner
+	for i, result := range results {
+		for _, minerAddr := range result.([]address.Address) {
+			miners = append(miners, &pledgedMiner{agentID: uint64(i + 1), miner: minerAddr})
+		}
 	}
-	defer closer()
 
-	var tsk types.TipSetKey = types.EmptyTSK
-	if blockNumber != nil {
-		ts, err := lapi.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(blockNumber.Int64()), types.EmptyTSK)
-		if err != nil {
-			return nil, nil, nil, nil, nil, nil, err
-		}
-		tsk = ts.Key()
+	tasks = make([]util.TaskFunc, len(miners))
+	for i, miner := range miners {
+		tasks[i] = createStateBalanceTask(ctx, lapi, miner.miner, tsk)
 	}
 
-	var allMiners []address.Address
-	for _, result := range results {
-		agentMiners := result.([]address.Address)
-		allMiners = append(allMiners, agentMiners...)
+	bals, err := util.Multiread(tasks)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	tasks = make([]util.TaskFunc, len(allMiners))
-	for i, minerAddr := range allMiners {
-		tasks[i] = createStateBalanceTask(ctx, lapi, minerAddr, tsk)
+	tasks = make([]util.TaskFunc, len(miners))
+	for i, miner := range miners {
+		tasks[i] = createSectorPowerTask(ctx, lapi, miner.miner, tsk)
 	}
 
-	bals, err := util.Multiread(tasks)
+	sectorPows, err := util.Multiread(tasks)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, nil, err
 	}
 
-	var totalMinerCollaterals = big.NewInt(0)
-	for _, bal := range bals {
-		totalMinerCollaterals.Add(totalMinerCollaterals, bal.(*big.Int))
+	for i, miner := range miners {
+		miner.balance = bals[i].(*big.Int)
+		miner.power = sectorPows[i].(*MinerSectorsPower)
 	}
 
-	tasks = make([]util.TaskFunc, len(allMiners))
-	for i, minerAddr := range allMiners {
-		tasks[i] = createSectorPowerTask(ctx, lapi, minerAddr, tsk)
-	}
+	return agentCount, miners, nil
+}
 
-	sectorPows, err := util.Multiread(tasks)
+func minerCollateralsAt(ctx context.Context, q PoolQuerier, lapi LotusAPI, agents AgentLister, ts *types.TipSet) (*minerTotals, error) {
+	blockNumber := tipSetBlockNumber(ts)
+
+	agentCount, miners, err := pledgedMinersAt(ctx, q, lapi, ts)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, err
 	}
 
-	totalMinerSectors = big.NewInt(0)
-	totalMinerQAP = big.NewInt(0)
-	totalMinerRBP = big.NewInt(0)
-	for _, sectorPow := range sectorPows {
-		minerSectorPow := sectorPow.(*MinerSectorsPower)
-		totalMinerSectors.Add(totalMinerSectors, minerSectorPow.sectors)
-		totalMinerQAP.Add(totalMinerQAP, minerSectorPow.qap)
-		totalMinerRBP.Add(totalMinerRBP, minerSectorPow.rbp)
+	var totalMinerCollaterals = big.NewInt(0)
+	totalSectorPow := newMinerSectorsPower()
+	eligibleQAP := big.NewInt(0)
+	eligibleRBP := big.NewInt(0)
+	for _, miner := range miners {
+		totalMinerCollaterals.Add(totalMinerCollaterals, miner.balance)
+		totalSectorPow.add(miner.power)
+		if miner.power.hasMinPower {
+			eligibleQAP.Add(eligibleQAP, miner.power.qap)
+			eligibleRBP.Add(eligibleRBP, miner.power.rbp)
+		}
 	}
 
-	totalIssuedFIL, err := sdk.Query().InfPoolTotalBorrowed(ctx, blockNumber)
+	networkQAP, networkRBP, err := networkPowerAt(ctx, lapi, ts.Key())
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, err
+	}
+
+	totalIssuedFIL, err := q.InfPoolTotalBorrowed(ctx, blockNumber)
+	if err != nil {
+		return nil, err
 	}
 	totalMinerCollaterals.Sub(totalMinerCollaterals, util.ToAtto(totalIssuedFIL))
 
 	// count the assets held on agents as miner collaterals
-	agentsLiquidAssets, err := AgentsLiquidAssets(ctx, sdk, blockNumber)
+	agentsLiquidAssets, err := AgentsLiquidAssets(ctx, q, agents, blockNumber)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, err
 	}
 	totalMinerCollaterals.Add(totalMinerCollaterals, agentsLiquidAssets)
 
-	return agentCount, big.NewInt(int64(len(allMiners))), totalMinerCollaterals, totalMinerSectors, totalMinerQAP, totalMinerRBP, nil
+	return &minerTotals{
+		agentCount:  agentCount,
+		minerCount:  big.NewInt(int64(len(miners))),
+		collaterals: totalMinerCollaterals,
+		sectors:     totalSectorPow,
+		eligibleQAP: eligibleQAP,
+		eligibleRBP: eligibleRBP,
+		networkQAP:  networkQAP,
+		networkRBP:  networkRBP,
+	}, nil
 }
 
-func createStateBalanceTask(ctx context.Context, lapi *api.FullNodeStruct, addr address.Address, tsk types.TipSetKey) util.TaskFunc {
+// networkPowerAt returns the network's total QAP and RBP at tsk, the power of the miners above
+// the consensus minimum power. StateMinerPower reports only the totals for an undefined miner.
+func networkPowerAt(ctx context.Context, lapi LotusAPI, tsk types.TipSetKey) (*big.Int, *big.Int, error) {
+	pow, err := lapi.StateMinerPower(ctx, address.Undef, tsk)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pow.TotalPower.QualityAdjPower.Int, pow.TotalPower.RawBytePower.Int, nil
+}
+
+func createStateBalanceTask(ctx context.Context, lapi LotusAPI, addr address.Address, tsk types.TipSetKey) util.TaskFunc {
 	return func() (interface{}, error) {
 		state, err := lapi.StateReadState(ctx, addr, tsk)
 		if err != nil {
@@ -226,20 +316,47 @@ func createStateBalanceTask(ctx context.Context, lapi *api.FullNodeStruct, addr
 	}
 }
 
-func createAgentLiquidAssetTask(ctx context.Context, sdk pooltypes.PoolsSDK, agentAddr common.Address, blockNumber *big.Int) util.TaskFunc {
+func createAgentLiquidAssetTask(ctx context.Context, q PoolQuerier, agentAddr common.Address, blockNumber *big.Int) util.TaskFunc {
 	return func() (interface{}, error) {
-		return sdk.Query().AgentLiquidAssets(ctx, agentAddr, blockNumber)
+		return q.AgentLiquidAssets(ctx, agentAddr, blockNumber)
 	}
 }
 
 type MinerSectorsPower struct {
-	miner   address.Address
-	sectors *big.Int
-	qap     *big.Int
-	rbp     *big.Int
+	miner address.Address
+	// live sectors
+	sectors    *big.Int
+	active     *big.Int
+	faulty     *big.Int
+	recovering *big.Int
+	qap        *big.Int
+	rbp        *big.Int
+	// whether the miner meets the consensus minimum power to win blocks
+	hasMinPower bool
+}
+
+func newMinerSectorsPower() *MinerSectorsPower {
+	return &MinerSectorsPower{
+		sectors:    big.NewInt(0),
+		active:     big.NewInt(0),
+		faulty:     big.NewInt(0),
+		recovering: big.NewInt(0),
+		qap:        big.NewInt(0),
+		rbp:        big.NewInt(0),
+	}
+}
+
+// add sums the sectors and power of other into p
+func (p *MinerSectorsPower) add(other *MinerSectorsPower) {
+	p.sectors.Add(p.sectors, other.sectors)
+	p.active.Add(p.active, other.active)
+	p.faulty.Add(p.faulty, other.faulty)
+	p.recovering.Add(p.recovering, other.recovering)
+	p.qap.Add(p.qap, other.qap)
+	p.rbp.Add(p.rbp, other.rbp)
 }
 
-func createSectorPowerTask(ctx context.Context, lapi *api.FullNodeStruct, addr address.Address, tsk types.TipSetKey) util.TaskFunc {
+func createSectorPowerTask(ctx context.Context, lapi LotusAPI, addr address.Address, tsk types.TipSetKey) util.TaskFunc {
 	return func() (interface{}, error) {
 
 		pow, err := lapi.StateMinerPower(ctx, addr, tsk)
@@ -247,11 +364,30 @@ func createSectorPowerTask(ctx context.Context, lapi *api.FullNodeStruct, addr a
 			return nil, err
 		}
 
+		sectors, err := lapi.StateMinerSectorCount(ctx, addr, tsk)
+		if err != nil {
+			return nil, err
+		}
+
+		recoveries, err := lapi.StateMinerRecoveries(ctx, addr, tsk)
+		if err != nil {
+			return nil, err
+		}
+
+		recovering, err := recoveries.Count()
+		if err != nil {
+			return nil, err
+		}
+
 		return &MinerSectorsPower{
-			miner:   addr,
-			sectors: big.NewInt(0),
-			qap:     pow.MinerPower.QualityAdjPower.Int,
-			rbp:     pow.MinerPower.RawBytePower.Int,
+			miner:       addr,
+			sectors:     new(big.Int).SetUint64(sectors.Live),
+			active:      new(big.Int).SetUint64(sectors.Active),
+			faulty:      new(big.Int).SetUint64(sectors.Faulty),
+			recovering:  new(big.Int).SetUint64(recovering),
+			qap:         pow.MinerPower.QualityAdjPower.Int,
+			rbp:         pow.MinerPower.RawBytePower.Int,
+			hasMinPower: pow.HasMinPower,
 		}, nil
 	}
 }
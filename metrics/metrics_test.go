@@ -6,91 +6,313 @@ import (
 	"testing"
 
 	"github.com/filecoin-project/go-address"
-	"github.com/glifio/go-pools/constants"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
 	psdk "github.com/glifio/go-pools/sdk"
-	"github.com/glifio/pools-metrics/common"
+	"github.com/glifio/pools-metrics/metrics/metricstest"
 )
 
-func TestMetrics(t *testing.T) {
-	ctx := context.Background()
+// testEnv wires the metrics functions to the metricstest fakes
+type testEnv struct {
+	fixture *metricstest.Fixture
+	pool    *metricstest.Pool
+	lapi    *api.FullNodeStruct
+	agents  AgentLister
+	stats   MinerStatsAPI
+}
 
-	chainID := big.NewInt(constants.MainnetChainID)
-	extern, err := common.GetExtern(chainID)
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
 
-	sdk, err := psdk.New(ctx, chainID, extern)
-	metrics, err := Metrics(ctx, sdk, nil)
+	fixture, err := metricstest.LoadFixture("testdata/fixture.json")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if metrics.PoolTotalAssets.Cmp(big.NewInt(0)) != 1 {
-		t.Fatal("PoolTotalAssets should be greater than 0")
-	}
-	if metrics.PoolTotalBorrowed.Cmp(big.NewInt(0)) != 1 {
-		t.Fatal("PoolTotalBorrwed should be greater than 0")
+	lotus := metricstest.NewLotus(fixture)
+	t.Cleanup(lotus.Close)
+
+	lapi, closer, err := lotus.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
 	}
-	if metrics.TotalAgentCount.Cmp(big.NewInt(0)) != 1 {
-		t.Fatal("TotalAgentCount should be greater than 0")
+	t.Cleanup(closer)
+
+	events := metricstest.NewAgentsServer(fixture)
+	t.Cleanup(events.Close)
+
+	return &testEnv{
+		fixture: fixture,
+		pool:    metricstest.NewPool(fixture),
+		lapi:    lapi,
+		agents:  &EventsAgentLister{URL: events.URL + "/agent/list"},
+		stats:   metricstest.NewMinerStats(fixture),
 	}
-	if metrics.TotalMinerCollaterals.Cmp(big.NewInt(0)) != 1 {
-		t.Fatal("TotalMinerCollaterals should be greater than 0")
+}
+
+func fil(amount string) *big.Int {
+	return types.MustParseFIL(amount).Int
+}
+
+func assertBigInt(t *testing.T, name string, got *big.Int, want *big.Int) {
+	t.Helper()
+	if got == nil || got.Cmp(want) != 0 {
+		t.Fatalf("%s: got %v, want %v", name, got, want)
 	}
-	if metrics.TotalMinersCount.Cmp(big.NewInt(0)) != 1 {
-		t.Fatal("TotalMinersCount should be greater than 0")
+}
+
+func assertRat(t *testing.T, name string, got *big.Rat, want *big.Rat) {
+	t.Helper()
+	if got == nil || got.Cmp(want) != 0 {
+		t.Fatalf("%s: got %v, want %v", name, got, want)
 	}
-	if metrics.TotalMinersSectors.Cmp(big.NewInt(0)) != 1 {
-		t.Fatal("TotalMinersSectors should be greater than 0")
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	metrics, err := Metrics(ctx, env.pool, env.lapi, env.agents, nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if metrics.TotalMinerQAP.Cmp(big.NewInt(0)) != 1 {
-		t.Fatal("TotalMinerQAP should be greater than 0")
+
+	assertBigInt(t, "PoolTotalAssets", metrics.PoolTotalAssets, fil("2000000"))
+	assertBigInt(t, "PoolTotalBorrowed", metrics.PoolTotalBorrowed, fil("3000"))
+	assertBigInt(t, "PoolTotalBorrowableAssets", metrics.PoolTotalBorrowableAssets, fil("1000000"))
+	assertBigInt(t, "PoolExitReserve", metrics.PoolExitReserve, fil("100000"))
+	assertBigInt(t, "TotalAgentCount", metrics.TotalAgentCount, big.NewInt(3))
+	assertBigInt(t, "TotalMinersCount", metrics.TotalMinersCount, big.NewInt(4))
+	// 4050 FIL of miner balances - 3000 FIL borrowed + 15 FIL liquid on agents
+	assertBigInt(t, "TotalMinerCollaterals", metrics.TotalMinerCollaterals, fil("1065"))
+	assertBigInt(t, "TotalValueLocked", metrics.TotalValueLocked, fil("2001065"))
+	assertBigInt(t, "TotalMinersSectors", metrics.TotalMinersSectors, big.NewInt(3532))
+	assertBigInt(t, "TotalActiveSectors", metrics.TotalActiveSectors, big.NewInt(3472))
+	assertBigInt(t, "TotalFaultySectors", metrics.TotalFaultySectors, big.NewInt(60))
+	assertBigInt(t, "TotalRecoveringSectors", metrics.TotalRecoveringSectors, big.NewInt(24))
+	// 35 PiB and 1 TiB
+	assertBigInt(t, "TotalMinerQAP", metrics.TotalMinerQAP, big.NewInt(39406496739491840+1099511627776))
+	// 8 PiB and 1 TiB
+	assertBigInt(t, "TotalMinerRBP", metrics.TotalMinerRBP, big.NewInt(9007199254740992+1099511627776))
+
+	assertBigInt(t, "NetworkQAP", metrics.NetworkQAP, env.fixture.NetworkQAP.Int)
+	assertBigInt(t, "NetworkRBP", metrics.NetworkRBP, env.fixture.NetworkRBP.Int)
+	// f01003 is below the minimum power and left out of the network totals, leaving 35 PiB of 25 EiB
+	// and 8 PiB of 10 EiB
+	assertRat(t, "QAPShare", metrics.QAPShare, big.NewRat(35, 25*1024))
+	assertRat(t, "RBPShare", metrics.RBPShare, big.NewRat(8, 10*1024))
+	// f01003 wins no blocks either
+	assertRat(t, "BlockRewardShare", metrics.BlockRewardShare, big.NewRat(35, 25*1024))
+
+	assertRat(t, "Utilization", metrics.Utilization, big.NewRat(3, 2000))
+	assertRat(t, "BorrowableShare", metrics.BorrowableShare, big.NewRat(1, 2))
+	assertRat(t, "ExitReserveCoverage", metrics.ExitReserveCoverage, big.NewRat(1, 20))
+	assertBigInt(t, "WithdrawableLiquidity", metrics.WithdrawableLiquidity, fil("1100000"))
+
+	// without a block number, every query is pinned to the parent of the head
+	assertTipSet(t, env, metrics, env.fixture.Head-1)
+}
+
+func TestMetricsAtHeight(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	metrics, err := Metrics(ctx, env.pool, env.lapi, env.agents, big.NewInt(3000000))
+	if err != nil {
+		t.Fatal(err)
 	}
-	if metrics.TotalMinerRBP.Cmp(big.NewInt(0)) != 1 {
-		t.Fatal("TotalMinerRBP should be greater than 0")
+
+	assertTipSet(t, env, metrics, 3000000)
+
+	// Lotus state is read at 3000000, when f01000 held 800 FIL and 9 PiB of QAP in a 24 EiB network
+	assertBigInt(t, "TotalMinerCollaterals", metrics.TotalMinerCollaterals, fil("865"))
+	assertBigInt(t, "TotalMinerQAP", metrics.TotalMinerQAP, big.NewInt(34*1125899906842624+1099511627776))
+	assertBigInt(t, "NetworkQAP", metrics.NetworkQAP, env.fixture.NetworkHistory[0].NetworkQAP.Int)
+	assertRat(t, "QAPShare", metrics.QAPShare, big.NewRat(34, 24*1024))
+}
+
+func assertTipSet(t *testing.T, env *testEnv, metrics *MetricData, height int64) {
+	t.Helper()
+
+	ts, err := env.fixture.TipSet(abi.ChainEpoch(height))
+	if err != nil {
+		t.Fatal(err)
 	}
 
+	assertBigInt(t, "Height", metrics.Height, big.NewInt(height))
+	if metrics.TipSetKey != ts.Key() {
+		t.Fatalf("TipSetKey: got %v, want %v", metrics.TipSetKey, ts.Key())
+	}
+	if metrics.Timestamp != ts.MinTimestamp() {
+		t.Fatalf("Timestamp: got %d, want %d", metrics.Timestamp, ts.MinTimestamp())
+	}
 }
 
 func TestAgentsLiquidAssets(t *testing.T) {
 	ctx := context.Background()
+	env := newTestEnv(t)
 
-	chainID := big.NewInt(constants.MainnetChainID)
-	extern, err := common.GetExtern(chainID)
+	liquidAssets, err := AgentsLiquidAssets(ctx, env.pool, env.agents, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	sdk, err := psdk.New(ctx, chainID, extern)
+	assertBigInt(t, "AgentsLiquidAssets", liquidAssets, fil("15"))
+}
+
+func TestMinerMaxBorrow(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	miner, err := address.NewFromString("f01000")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = AgentsLiquidAssets(ctx, sdk, nil)
+	maxBorrow, agentVal, edr, rate, err := MinerInfo(ctx, env.pool, env.lapi, env.stats, miner)
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	assertBigInt(t, "agentVal", agentVal, fil("1000"))
+	// 2 FIL lazy EDR + 180 FIL vesting / 180 days
+	assertBigInt(t, "edr", edr, fil("3"))
+	assertBigInt(t, "rate", rate, big.NewInt(95129375951))
+
+	// twice the 1000 FIL of equity, below the payment limit of 3 FIL / (rate * 2880) ~ 10950 FIL
+	assertBigInt(t, "maxBorrow", maxBorrow, fil("2000"))
 }
 
-func TestMinerMaxBorrow(t *testing.T) {
+func TestMinerInfoInputs(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	miner, err := address.NewFromString("f01000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := MinerInfoAt(ctx, env.pool, env.lapi, env.stats, miner, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := info.Inputs
+	assertBigInt(t, "LazyEDR", inputs.LazyEDR, fil("2"))
+	assertBigInt(t, "VestingFunds", inputs.VestingFunds, fil("180"))
+	if inputs.VestingDays != 180 {
+		t.Fatalf("VestingDays: got %d, want 180", inputs.VestingDays)
+	}
+	assertBigInt(t, "VestingComponent", inputs.VestingComponent, fil("1"))
+
+	// the credential and the borrow cap see the same agent data
+	assertBigInt(t, "AgentData.AgentValue", inputs.AgentData.AgentValue, info.AgentValue)
+	assertBigInt(t, "AgentData.ExpectedDailyRewards", inputs.AgentData.ExpectedDailyRewards, info.EDR)
+	assertBigInt(t, "AgentData.Gcred", inputs.AgentData.Gcred, big.NewInt(100))
+	assertBigInt(t, "AgentData.Principal", inputs.AgentData.Principal, big.NewInt(0))
+	assertBigInt(t, "MaxBorrow", info.MaxBorrow, fil("2000"))
+}
+
+func TestMinerInfoAtHeight(t *testing.T) {
 	ctx := context.Background()
+	env := newTestEnv(t)
+
+	miner, err := address.NewFromString("f01000")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	chainID := big.NewInt(constants.MainnetChainID)
-	extern, err := common.GetExtern(chainID)
+	info, err := MinerInfoAt(ctx, env.pool, env.lapi, env.stats, miner, big.NewInt(3000000))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	sdk, err := psdk.New(ctx, chainID, extern)
+	assertBigInt(t, "Height", info.Height, big.NewInt(3000000))
+	// f01000 held 800 FIL at 3000000, and the pool charged less than it does at the head
+	assertBigInt(t, "AgentValue", info.AgentValue, fil("800"))
+	assertBigInt(t, "Rate", info.Rate, big.NewInt(63419583967))
+	if info.Rate.Cmp(env.fixture.Pool.Rate.Int) == 0 {
+		t.Fatal("expected the rate at the requested height, not the current rate")
+	}
+}
+
+func TestBatchMinerInfo(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	var miners []address.Address
+	for _, m := range []string{"f01000", "f09999", "f01002"} {
+		addr, err := address.NewFromString(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		miners = append(miners, addr)
+	}
+
+	results, err := BatchMinerInfo(ctx, env.pool, env.lapi, env.stats, miners, nil, 2)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	miner, err := address.NewFromString("f01931245")
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Miner != miners[i] {
+			t.Fatalf("result %d: got miner %s, want %s", i, result.Miner, miners[i])
+		}
+	}
+
+	// the unknown miner fails on its own
+	if results[1].Err == nil || results[1].Info != nil {
+		t.Fatal("expected an error for an unknown miner")
+	}
+	if results[0].Err != nil || results[2].Err != nil {
+		t.Fatalf("unexpected errors %v, %v", results[0].Err, results[2].Err)
+	}
+	assertBigInt(t, "AgentValue", results[2].Info.AgentValue, fil("2500"))
+	// every miner is evaluated at the same tipset
+	assertBigInt(t, "Height", results[0].Info.Height, results[2].Info.Height)
+}
+
+func TestSetRatiosWithoutAssets(t *testing.T) {
+	metrics := &MetricData{
+		PoolTotalAssets:           big.NewInt(0),
+		PoolTotalBorrowed:         big.NewInt(0),
+		PoolTotalBorrowableAssets: big.NewInt(0),
+		PoolExitReserve:           big.NewInt(0),
+	}
+	metrics.SetRatios()
+
+	assertRat(t, "Utilization", metrics.Utilization, new(big.Rat))
+	assertRat(t, "BorrowableShare", metrics.BorrowableShare, new(big.Rat))
+	assertRat(t, "ExitReserveCoverage", metrics.ExitReserveCoverage, new(big.Rat))
+	assertBigInt(t, "WithdrawableLiquidity", metrics.WithdrawableLiquidity, big.NewInt(0))
+}
+
+// the fake pool's rate and max borrow are stand-ins, this checks miner info against go-pools' credential
+// encoding and max borrow formula
+func TestMinerInfoRateModule(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	chain := newRateModuleChain(func(blockNumber *big.Int) *big.Int { return env.fixture.RateAt(blockNumber).Int })
+	q := NewPoolRateQuerier(env.pool, NewRateModule(chain, chain.pool))
+
+	miner, err := address.NewFromString("f01000")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, _, _, _, err = MinerInfo(ctx, sdk, miner)
+	info, err := MinerInfoAt(ctx, q, env.lapi, env.stats, miner, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	assertBigInt(t, "AgentData.AgentValue", info.Inputs.AgentData.AgentValue, fil("1000"))
+	assertBigInt(t, "AgentData.ExpectedDailyRewards", info.Inputs.AgentData.ExpectedDailyRewards, fil("3"))
+	chain.assertCredential(t, info.Inputs.AgentData)
+	assertBigInt(t, "Rate", info.Rate, big.NewInt(95129375951))
+	assertBigInt(t, "MaxBorrow", info.MaxBorrow, psdk.MaxBorrowFromAgentData(info.Inputs.AgentData, info.Rate))
 }
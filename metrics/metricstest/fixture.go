@@ -0,0 +1,274 @@
+// Package metricstest provides an in-process fake Lotus node and fake pool contracts,
+// backed by fixture files, for exercising the metrics package without network access.
+package metricstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+)
+
+// Fixture is the chain and pool state served by the fakes. FIL values are in attoFIL.
+type Fixture struct {
+	Head             int64        `json:"head"`
+	GenesisTimestamp uint64       `json:"genesisTimestamp"`
+	NetworkQAP       types.BigInt `json:"networkQap"`
+	NetworkRBP       types.BigInt `json:"networkRbp"`
+	// block reward paid out by the reward actor every epoch
+	ThisEpochReward types.BigInt             `json:"thisEpochReward"`
+	Miners          map[string]*MinerFixture `json:"miners"`
+	Agents          []*AgentFixture          `json:"agents"`
+	Pool            PoolFixture              `json:"pool"`
+	// earlier network power in height order, see NetworkPowerAt
+	NetworkHistory []*NetworkSnapshotFixture `json:"networkHistory"`
+
+	// heights of the tipsets handed out by TipSet, see HeightOf
+	tipSetsMu sync.Mutex
+	tipSets   map[types.TipSetKey]abi.ChainEpoch
+}
+
+// NetworkSnapshotFixture is the network's power up to and including Height
+type NetworkSnapshotFixture struct {
+	Height     int64        `json:"height"`
+	NetworkQAP types.BigInt `json:"networkQap"`
+	NetworkRBP types.BigInt `json:"networkRbp"`
+}
+
+// MinerFixture is the state of a single miner actor
+type MinerFixture struct {
+	Balance types.BigInt `json:"balance"`
+	// balance not locked in pledge, vesting rewards or pre-commit deposits
+	AvailableBalance types.BigInt   `json:"availableBalance"`
+	QAP              types.BigInt   `json:"qap"`
+	RBP              types.BigInt   `json:"rbp"`
+	EDR              types.BigInt   `json:"edr"`
+	VestingFunds     types.BigInt   `json:"vestingFunds"`
+	SectorSize       abi.SectorSize `json:"sectorSize"`
+	// under the consensus minimum power, so not eligible to win blocks
+	BelowMinPower bool           `json:"belowMinPower"`
+	Sectors       SectorsFixture `json:"sectors"`
+	// earlier balances and power in height order, see MinerAt
+	History []*MinerSnapshotFixture `json:"history"`
+}
+
+// MinerSnapshotFixture is a miner's balance and power up to and including Height
+type MinerSnapshotFixture struct {
+	Height  int64        `json:"height"`
+	Balance types.BigInt `json:"balance"`
+	QAP     types.BigInt `json:"qap"`
+	RBP     types.BigInt `json:"rbp"`
+}
+
+// SectorsFixture counts a miner's sectors by state
+type SectorsFixture struct {
+	Live       uint64 `json:"live"`
+	Active     uint64 `json:"active"`
+	Faulty     uint64 `json:"faulty"`
+	Recovering uint64 `json:"recovering"`
+	// faulty sectors filled with verified deals, the other sectors are committed capacity
+	VerifiedFaulty uint64 `json:"verifiedFaulty"`
+}
+
+// AgentFixture is a single agent and the miners pledged to it
+type AgentFixture struct {
+	ID           uint64         `json:"id"`
+	Address      common.Address `json:"address"`
+	LiquidAssets types.BigInt   `json:"liquidAssets"`
+	Principal    types.BigInt   `json:"principal"`
+	Miners       []string       `json:"miners"`
+}
+
+// PoolFixture is the state of the infinity pool contracts
+type PoolFixture struct {
+	TotalAssets         types.BigInt `json:"totalAssets"`
+	IFILSupply          types.BigInt `json:"ifilSupply"`
+	TotalBorrowed       types.BigInt `json:"totalBorrowed"`
+	BorrowableLiquidity types.BigInt `json:"borrowableLiquidity"`
+	ExitReserve         types.BigInt `json:"exitReserve"`
+	Apy                 types.BigInt `json:"apy"`
+	Rate                types.BigInt `json:"rate"`
+	// the pool contracts have no code below this height
+	DeployedAt int64 `json:"deployedAt"`
+	// earlier pool states in height order, see PoolAt
+	History []*PoolSnapshotFixture `json:"history"`
+}
+
+// PoolSnapshotFixture is the pool's total assets, iFIL supply and rate up to and including Height
+type PoolSnapshotFixture struct {
+	Height      int64        `json:"height"`
+	TotalAssets types.BigInt `json:"totalAssets"`
+	IFILSupply  types.BigInt `json:"ifilSupply"`
+	Rate        types.BigInt `json:"rate"`
+}
+
+// PoolAt returns the pool's total assets and iFIL supply at blockNumber, see snapshotAt
+func (f *Fixture) PoolAt(blockNumber *big.Int) (totalAssets types.BigInt, ifilSupply types.BigInt) {
+	if snapshot := f.snapshotAt(blockNumber); snapshot != nil {
+		return snapshot.TotalAssets, snapshot.IFILSupply
+	}
+
+	return f.Pool.TotalAssets, f.Pool.IFILSupply
+}
+
+// RateAt returns the rate the pool charges at blockNumber, see snapshotAt
+func (f *Fixture) RateAt(blockNumber *big.Int) types.BigInt {
+	if snapshot := f.snapshotAt(blockNumber); snapshot != nil {
+		return snapshot.Rate
+	}
+
+	return f.Pool.Rate
+}
+
+// snapshotAt returns the first history entry at or above blockNumber,
+// or nil for the latest state when blockNumber is nil or above every entry
+func (f *Fixture) snapshotAt(blockNumber *big.Int) *PoolSnapshotFixture {
+	if blockNumber != nil {
+		for _, snapshot := range f.Pool.History {
+			if blockNumber.Int64() <= snapshot.Height {
+				return snapshot
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadFixture reads a fixture from a JSON file
+func LoadFixture(path string) (*Fixture, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f Fixture
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+
+	return &f, nil
+}
+
+// Miner returns the fixture of a miner actor
+func (f *Fixture) Miner(addr address.Address) (*MinerFixture, error) {
+	miner, ok := f.Miners[addr.String()]
+	if !ok {
+		return nil, fmt.Errorf("actor not found: %s", addr)
+	}
+
+	return miner, nil
+}
+
+// MinerAt returns the fixture of a miner actor with its balance and power at height,
+// taken from the first history entry at or above height
+func (f *Fixture) MinerAt(addr address.Address, height abi.ChainEpoch) (*MinerFixture, error) {
+	miner, err := f.Miner(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snapshot := range miner.History {
+		if int64(height) <= snapshot.Height {
+			at := *miner
+			at.Balance = snapshot.Balance
+			at.QAP = snapshot.QAP
+			at.RBP = snapshot.RBP
+			return &at, nil
+		}
+	}
+
+	return miner, nil
+}
+
+// NetworkPowerAt returns the network's QAP and RBP at height, taken from the first history entry at or above height
+func (f *Fixture) NetworkPowerAt(height abi.ChainEpoch) (qap types.BigInt, rbp types.BigInt) {
+	for _, snapshot := range f.NetworkHistory {
+		if int64(height) <= snapshot.Height {
+			return snapshot.NetworkQAP, snapshot.NetworkRBP
+		}
+	}
+
+	return f.NetworkQAP, f.NetworkRBP
+}
+
+// HeightOf returns the height of a tipset handed out by TipSet, or of the head for the empty key,
+// so state can be served as of the requested tipset
+func (f *Fixture) HeightOf(tsk types.TipSetKey) (abi.ChainEpoch, error) {
+	if tsk.IsEmpty() {
+		return abi.ChainEpoch(f.Head), nil
+	}
+
+	f.tipSetsMu.Lock()
+	defer f.tipSetsMu.Unlock()
+	height, ok := f.tipSets[tsk]
+	if !ok {
+		return 0, fmt.Errorf("tipset not found: %s", tsk)
+	}
+
+	return height, nil
+}
+
+// fakeCid is used for every CID field of the fake block headers
+var fakeCid = cid.MustParse("bafyreicmaj5hhoy5mgqvamfhgexxyergw7hdeshizghodwkjg6qmpoco7i")
+
+// TipSet returns a single block tipset at height. Tipsets are deterministic, so the
+// same height always yields the same tipset key.
+func (f *Fixture) TipSet(height abi.ChainEpoch) (*types.TipSet, error) {
+	if int64(height) > f.Head {
+		return nil, fmt.Errorf("looking for tipset with height greater than head (%d > %d)", height, f.Head)
+	}
+	if height < 0 {
+		return nil, fmt.Errorf("invalid height %d", height)
+	}
+
+	miner, err := address.NewIDAddress(1000)
+	if err != nil {
+		return nil, err
+	}
+
+	ts, err := types.NewTipSet([]*types.BlockHeader{{
+		Miner:                 miner,
+		Ticket:                &types.Ticket{VRFProof: []byte("fake ticket")},
+		ElectionProof:         &types.ElectionProof{VRFProof: []byte("fake election proof")},
+		ParentWeight:          types.NewInt(uint64(height)),
+		Height:                height,
+		ParentStateRoot:       fakeCid,
+		ParentMessageReceipts: fakeCid,
+		Messages:              fakeCid,
+		BLSAggregate:          &crypto.Signature{Type: crypto.SigTypeBLS, Data: []byte("fake signature")},
+		Timestamp:             f.Timestamp(height),
+		BlockSig:              &crypto.Signature{Type: crypto.SigTypeBLS, Data: []byte("fake signature")},
+		ParentBaseFee:         types.NewInt(100),
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	f.tipSetsMu.Lock()
+	defer f.tipSetsMu.Unlock()
+	if f.tipSets == nil {
+		f.tipSets = make(map[types.TipSetKey]abi.ChainEpoch)
+	}
+	f.tipSets[ts.Key()] = height
+
+	return ts, nil
+}
+
+// Timestamp returns the block timestamp of height
+func (f *Fixture) Timestamp(height abi.ChainEpoch) uint64 {
+	return f.GenesisTimestamp + uint64(height)*30
+}
+
+// FIL returns an attoFIL value as an exact FIL *big.Float, the way the pools SDK reports pool balances
+func FIL(atto types.BigInt) *big.Float {
+	val := new(big.Float).SetPrec(256).SetInt(atto.Int)
+	return val.Quo(val, new(big.Float).SetPrec(256).SetInt64(1e18))
+}
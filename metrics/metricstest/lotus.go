@@ -0,0 +1,254 @@
+package metricstest
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/power"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/reward"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// Lotus is a fake Lotus node serving the Filecoin JSON-RPC API from a fixture
+type Lotus struct {
+	fixture *Fixture
+	server  *httptest.Server
+}
+
+// NewLotus starts a fake Lotus node. Callers must Close it when done.
+func NewLotus(f *Fixture) *Lotus {
+	rpc := jsonrpc.NewServer()
+	rpc.Register("Filecoin", &lotusHandler{fixture: f})
+
+	return &Lotus{
+		fixture: f,
+		server:  httptest.NewServer(rpc),
+	}
+}
+
+// URL returns the websocket address of the fake node's JSON-RPC endpoint
+func (l *Lotus) URL() string {
+	return "ws" + strings.TrimPrefix(l.server.URL, "http")
+}
+
+// Connect dials the fake node, returning the same client type as the pools SDK
+func (l *Lotus) Connect(ctx context.Context) (*api.FullNodeStruct, jsonrpc.ClientCloser, error) {
+	var lapi api.FullNodeStruct
+	closer, err := jsonrpc.NewMergeClient(ctx, l.URL(), "Filecoin", api.GetInternalStructs(&lapi), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &lapi, closer, nil
+}
+
+func (l *Lotus) Close() {
+	l.server.Close()
+}
+
+// sectorLifetime is the number of epochs every fake sector is committed for
+const sectorLifetime = 540 * builtin.EpochsInDay
+
+// lotusHandler implements the subset of the Lotus full node API registered on the fake node
+type lotusHandler struct {
+	fixture *Fixture
+}
+
+func (h *lotusHandler) ChainHead(ctx context.Context) (*types.TipSet, error) {
+	return h.fixture.TipSet(abi.ChainEpoch(h.fixture.Head))
+}
+
+func (h *lotusHandler) ChainGetTipSetByHeight(ctx context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	from, err := h.fixture.HeightOf(tsk)
+	if err != nil {
+		return nil, err
+	}
+	if height > from {
+		return nil, fmt.Errorf("looking for tipset with height greater than start point (%d > %d)", height, from)
+	}
+
+	return h.fixture.TipSet(height)
+}
+
+// minerAt returns a miner's fixture as of the tipset tsk
+func (h *lotusHandler) minerAt(addr address.Address, tsk types.TipSetKey) (*MinerFixture, error) {
+	height, err := h.fixture.HeightOf(tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.fixture.MinerAt(addr, height)
+}
+
+func (h *lotusHandler) StateGetActor(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*types.Actor, error) {
+	miner, err := h.minerAt(addr, tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.Actor{
+		Code:    fakeCid,
+		Head:    fakeCid,
+		Balance: miner.Balance,
+	}, nil
+}
+
+func (h *lotusHandler) StateReadState(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*api.ActorState, error) {
+	if addr == reward.Address {
+		if _, err := h.fixture.HeightOf(tsk); err != nil {
+			return nil, err
+		}
+		return &api.ActorState{
+			State: map[string]interface{}{"ThisEpochReward": h.fixture.ThisEpochReward},
+		}, nil
+	}
+
+	miner, err := h.minerAt(addr, tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.ActorState{
+		Balance: miner.Balance,
+	}, nil
+}
+
+func (h *lotusHandler) StateMinerAvailableBalance(ctx context.Context, addr address.Address, tsk types.TipSetKey) (types.BigInt, error) {
+	miner, err := h.minerAt(addr, tsk)
+	if err != nil {
+		return types.EmptyInt, err
+	}
+
+	return miner.AvailableBalance, nil
+}
+
+func (h *lotusHandler) StateMinerFaults(ctx context.Context, addr address.Address, tsk types.TipSetKey) (bitfield.BitField, error) {
+	miner, err := h.minerAt(addr, tsk)
+	if err != nil {
+		return bitfield.BitField{}, err
+	}
+
+	return sectorsBitField(miner.Sectors.Faulty), nil
+}
+
+func (h *lotusHandler) StateMinerInfo(ctx context.Context, addr address.Address, tsk types.TipSetKey) (api.MinerInfo, error) {
+	miner, err := h.minerAt(addr, tsk)
+	if err != nil {
+		return api.MinerInfo{}, err
+	}
+
+	return api.MinerInfo{
+		SectorSize: miner.SectorSize,
+	}, nil
+}
+
+// StateMinerPower reports only the network totals for an undefined miner, like Lotus does
+func (h *lotusHandler) StateMinerPower(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*api.MinerPower, error) {
+	height, err := h.fixture.HeightOf(tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	networkQAP, networkRBP := h.fixture.NetworkPowerAt(height)
+	total := power.Claim{
+		RawBytePower:    networkRBP,
+		QualityAdjPower: networkQAP,
+	}
+	if addr == address.Undef {
+		return &api.MinerPower{
+			MinerPower: power.Claim{RawBytePower: big.Zero(), QualityAdjPower: big.Zero()},
+			TotalPower: total,
+		}, nil
+	}
+
+	miner, err := h.fixture.MinerAt(addr, height)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.MinerPower{
+		MinerPower: power.Claim{
+			RawBytePower:    miner.RBP,
+			QualityAdjPower: miner.QAP,
+		},
+		TotalPower:  total,
+		HasMinPower: !miner.BelowMinPower,
+	}, nil
+}
+
+func (h *lotusHandler) StateMinerSectorCount(ctx context.Context, addr address.Address, tsk types.TipSetKey) (api.MinerSectors, error) {
+	miner, err := h.minerAt(addr, tsk)
+	if err != nil {
+		return api.MinerSectors{}, err
+	}
+
+	return api.MinerSectors{
+		Live:   miner.Sectors.Live,
+		Active: miner.Sectors.Active,
+		Faulty: miner.Sectors.Faulty,
+	}, nil
+}
+
+func (h *lotusHandler) StateMinerRecoveries(ctx context.Context, addr address.Address, tsk types.TipSetKey) (bitfield.BitField, error) {
+	miner, err := h.minerAt(addr, tsk)
+	if err != nil {
+		return bitfield.BitField{}, err
+	}
+
+	return sectorsBitField(miner.Sectors.Recovering), nil
+}
+
+// StateMinerSectors numbers the faulty sectors first, the first VerifiedFaulty of them filled with verified deals.
+// Every sector is committed for sectorLifetime epochs.
+func (h *lotusHandler) StateMinerSectors(ctx context.Context, addr address.Address, filter *bitfield.BitField, tsk types.TipSetKey) ([]*miner.SectorOnChainInfo, error) {
+	m, err := h.minerAt(addr, tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	var sectors []*miner.SectorOnChainInfo
+	for i := uint64(0); i < m.Sectors.Live; i++ {
+		if filter != nil {
+			set, err := filter.IsSet(i)
+			if err != nil {
+				return nil, err
+			}
+			if !set {
+				continue
+			}
+		}
+
+		verifiedWeight := big.Zero()
+		if i < m.Sectors.VerifiedFaulty {
+			verifiedWeight = big.Mul(big.NewIntUnsigned(uint64(m.SectorSize)), big.NewInt(sectorLifetime))
+		}
+		sectors = append(sectors, &miner.SectorOnChainInfo{
+			SectorNumber:       abi.SectorNumber(i),
+			Activation:         0,
+			Expiration:         sectorLifetime,
+			DealWeight:         big.Zero(),
+			VerifiedDealWeight: verifiedWeight,
+		})
+	}
+
+	return sectors, nil
+}
+
+// sectorsBitField returns a bitfield holding sector numbers 0 to count-1
+func sectorsBitField(count uint64) bitfield.BitField {
+	sectors := make([]uint64, count)
+	for i := range sectors {
+		sectors[i] = uint64(i)
+	}
+	return bitfield.NewFromSet(sectors)
+}
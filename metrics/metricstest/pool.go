@@ -0,0 +1,217 @@
+package metricstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/go-pools/vc"
+)
+
+// WAD is the fixed point scale of per-epoch rates
+var WAD = big.NewInt(1e18)
+
+// Pool is a fake of the pool contract queries made through the pools SDK
+type Pool struct {
+	fixture *Fixture
+}
+
+func NewPool(f *Fixture) *Pool {
+	return &Pool{fixture: f}
+}
+
+func (p *Pool) ChainHead(ctx context.Context) (*types.TipSet, error) {
+	return p.fixture.TipSet(abi.ChainEpoch(p.fixture.Head))
+}
+
+func (p *Pool) AgentFactoryAgentCount(ctx context.Context, blockNumber *big.Int) (*big.Int, error) {
+	if err := p.deployed(blockNumber); err != nil {
+		return nil, err
+	}
+
+	return big.NewInt(int64(len(p.fixture.Agents))), nil
+}
+
+func (p *Pool) AgentLiquidAssets(ctx context.Context, agentAddr common.Address, blockNumber *big.Int) (*big.Int, error) {
+	if err := p.deployed(blockNumber); err != nil {
+		return nil, err
+	}
+
+	for _, agent := range p.fixture.Agents {
+		if agent.Address == agentAddr {
+			return new(big.Int).Set(agent.LiquidAssets.Int), nil
+		}
+	}
+
+	return nil, fmt.Errorf("agent not found: %s", agentAddr)
+}
+
+func (p *Pool) AgentPrincipal(ctx context.Context, agentAddr common.Address, blockNumber *big.Int) (*big.Int, error) {
+	if err := p.deployed(blockNumber); err != nil {
+		return nil, err
+	}
+
+	for _, agent := range p.fixture.Agents {
+		if agent.Address == agentAddr {
+			return new(big.Int).Set(agent.Principal.Int), nil
+		}
+	}
+
+	return nil, fmt.Errorf("agent not found: %s", agentAddr)
+}
+
+func (p *Pool) MinerRegistryAgentMinersList(ctx context.Context, agentID *big.Int, blockNumber *big.Int) ([]address.Address, error) {
+	if err := p.deployed(blockNumber); err != nil {
+		return nil, err
+	}
+
+	for _, agent := range p.fixture.Agents {
+		if agent.ID != agentID.Uint64() {
+			continue
+		}
+
+		miners := make([]address.Address, len(agent.Miners))
+		for i, m := range agent.Miners {
+			addr, err := address.NewFromString(m)
+			if err != nil {
+				return nil, err
+			}
+			miners[i] = addr
+		}
+		return miners, nil
+	}
+
+	return nil, fmt.Errorf("agent not found: %s", agentID)
+}
+
+func (p *Pool) InfPoolApy(ctx context.Context, blockNumber *big.Int) (*big.Int, error) {
+	if err := p.deployed(blockNumber); err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).Set(p.fixture.Pool.Apy.Int), nil
+}
+
+func (p *Pool) InfPoolBorrowableLiquidity(ctx context.Context, blockNumber *big.Int) (*big.Float, error) {
+	if err := p.deployed(blockNumber); err != nil {
+		return nil, err
+	}
+
+	return FIL(p.fixture.Pool.BorrowableLiquidity), nil
+}
+
+func (p *Pool) InfPoolExitReserve(ctx context.Context, blockNumber *big.Int) (*big.Int, *big.Int, error) {
+	if err := p.deployed(blockNumber); err != nil {
+		return nil, nil, err
+	}
+
+	return new(big.Int).Set(p.fixture.Pool.ExitReserve.Int), big.NewInt(0), nil
+}
+
+// deployed returns bind.ErrNoCode, like a call to a contract without code, below the pool's deployment height
+func (p *Pool) deployed(blockNumber *big.Int) error {
+	if blockNumber != nil && blockNumber.Int64() < p.fixture.Pool.DeployedAt {
+		return bind.ErrNoCode
+	}
+
+	return nil
+}
+
+// InfPoolGetRateAt charges the pool's rate at blockNumber, plus a premium of that rate scaled by the
+// agent's principal to value ratio
+func (p *Pool) InfPoolGetRateAt(ctx context.Context, data *vc.AgentData, blockNumber *big.Int) (*big.Int, error) {
+	if err := p.deployed(blockNumber); err != nil {
+		return nil, err
+	}
+
+	rate := new(big.Int).Set(p.fixture.RateAt(blockNumber).Int)
+	if data.AgentValue.Sign() > 0 {
+		premium := new(big.Int).Mul(rate, data.Principal)
+		rate.Add(rate, premium.Div(premium, data.AgentValue))
+	}
+
+	return rate, nil
+}
+
+// MaxBorrowFromAgentData is a fake of psdk.MaxBorrowFromAgentData with limits simple enough to check by hand.
+// Like the real formula it returns the FIL the agent can borrow on top of its principal, never less
+// than zero, capped by the lower of:
+//   - debt to equity: total principal up to twice the agent's equity (AgentValue - Principal)
+//   - payments: total principal whose daily interest at rate equals the agent's expected daily rewards
+func (p *Pool) MaxBorrowFromAgentData(data *vc.AgentData, rate *big.Int) *big.Int {
+	equity := new(big.Int).Sub(data.AgentValue, data.Principal)
+	limit := new(big.Int).Mul(equity, big.NewInt(2))
+
+	if rate.Sign() > 0 {
+		payment := new(big.Int).Mul(data.ExpectedDailyRewards, WAD)
+		payment.Div(payment, new(big.Int).Mul(rate, big.NewInt(builtin.EpochsInDay)))
+		if payment.Cmp(limit) < 0 {
+			limit = payment
+		}
+	}
+
+	limit.Sub(limit, data.Principal)
+	if limit.Sign() < 0 {
+		limit.SetInt64(0)
+	}
+
+	return limit
+}
+
+func (p *Pool) InfPoolTotalAssets(ctx context.Context, blockNumber *big.Int) (*big.Float, error) {
+	if err := p.deployed(blockNumber); err != nil {
+		return nil, err
+	}
+
+	totalAssets, _ := p.fixture.PoolAt(blockNumber)
+	return FIL(totalAssets), nil
+}
+
+func (p *Pool) InfPoolTotalBorrowed(ctx context.Context, blockNumber *big.Int) (*big.Float, error) {
+	if err := p.deployed(blockNumber); err != nil {
+		return nil, err
+	}
+
+	return FIL(p.fixture.Pool.TotalBorrowed), nil
+}
+
+func (p *Pool) IFILTotalSupply(ctx context.Context, blockNumber *big.Int) (*big.Float, error) {
+	if err := p.deployed(blockNumber); err != nil {
+		return nil, err
+	}
+
+	_, ifilSupply := p.fixture.PoolAt(blockNumber)
+	return FIL(ifilSupply), nil
+}
+
+// NewAgentsServer starts a fake glif events service listing the fixture's agents at /agent/list
+func NewAgentsServer(f *Fixture) *httptest.Server {
+	type agent struct {
+		ID      uint64         `json:"id"`
+		Address common.Address `json:"address"`
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/agent/list", func(w http.ResponseWriter, r *http.Request) {
+		agents := make([]agent, len(f.Agents))
+		for i, a := range f.Agents {
+			agents[i] = agent{ID: a.ID, Address: a.Address}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(agents); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
@@ -0,0 +1,36 @@
+package metricstest
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// MinerStats is a fake of the mstat computations, returning each miner's fixture values
+type MinerStats struct {
+	fixture *Fixture
+}
+
+func NewMinerStats(f *Fixture) *MinerStats {
+	return &MinerStats{fixture: f}
+}
+
+func (s *MinerStats) ExpectedDailyRewards(ctx context.Context, miner address.Address, ts *types.TipSet) (*big.Int, error) {
+	m, err := s.fixture.Miner(miner)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).Set(m.EDR.Int), nil
+}
+
+func (s *MinerStats) VestingFunds(ctx context.Context, miner address.Address, ts *types.TipSet) (*big.Int, error) {
+	m, err := s.fixture.Miner(miner)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).Set(m.VestingFunds.Int), nil
+}
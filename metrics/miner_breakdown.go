@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/go-pools/util"
+)
+
+// MinerBreakdown is the state of a single pledged miner
+type MinerBreakdown struct {
+	Miner   address.Address `json:"miner"`
+	AgentID uint64          `json:"agentId"`
+	Balance *big.Int        `json:"balance"`
+	// funds locked in initial pledge, vesting rewards and pre-commit deposits
+	LockedFunds       *big.Int `json:"lockedFunds"`
+	AvailableFunds    *big.Int `json:"availableFunds"`
+	QAP               *big.Int `json:"qap"`
+	RBP               *big.Int `json:"rbp"`
+	LiveSectors       *big.Int `json:"liveSectors"`
+	ActiveSectors     *big.Int `json:"activeSectors"`
+	FaultySectors     *big.Int `json:"faultySectors"`
+	RecoveringSectors *big.Int `json:"recoveringSectors"`
+}
+
+// MinerBreakdowns lists every pledged miner with its owning agent, funds, power and sectors at blockNumber
+func MinerBreakdowns(ctx context.Context, q PoolQuerier, lapi LotusAPI, blockNumber *big.Int) ([]*MinerBreakdown, error) {
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	_, miners, err := pledgedMinersAt(ctx, q, lapi, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]util.TaskFunc, len(miners))
+	for i, miner := range miners {
+		tasks[i] = createAvailableBalanceTask(ctx, lapi, miner.miner, ts.Key())
+	}
+
+	available, err := util.Multiread(tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdowns := make([]*MinerBreakdown, len(miners))
+	for i, miner := range miners {
+		availableFunds := available[i].(*big.Int)
+		breakdowns[i] = &MinerBreakdown{
+			Miner:             miner.miner,
+			AgentID:           miner.agentID,
+			Balance:           miner.balance,
+			LockedFunds:       new(big.Int).Sub(miner.balance, availableFunds),
+			AvailableFunds:    availableFunds,
+			QAP:               miner.power.qap,
+			RBP:               miner.power.rbp,
+			LiveSectors:       miner.power.sectors,
+			ActiveSectors:     miner.power.active,
+			FaultySectors:     miner.power.faulty,
+			RecoveringSectors: miner.power.recovering,
+		}
+	}
+
+	return breakdowns, nil
+}
+
+func createAvailableBalanceTask(ctx context.Context, lapi LotusAPI, addr address.Address, tsk types.TipSetKey) util.TaskFunc {
+	return func() (interface{}, error) {
+		bal, err := lapi.StateMinerAvailableBalance(ctx, addr, tsk)
+		if err != nil {
+			return nil, err
+		}
+
+		return bal.Int, nil
+	}
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+func TestMinerBreakdowns(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	miners, err := MinerBreakdowns(ctx, env.pool, env.lapi, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(miners) != 4 {
+		t.Fatalf("expected 4 miners, got %d", len(miners))
+	}
+
+	miner := miners[2]
+	if miner.Miner.String() != "f01002" || miner.AgentID != 2 {
+		t.Fatalf("unexpected miner %s of agent %d", miner.Miner, miner.AgentID)
+	}
+	assertBigInt(t, "Balance", miner.Balance, fil("2500"))
+	assertBigInt(t, "AvailableFunds", miner.AvailableFunds, fil("400"))
+	assertBigInt(t, "LockedFunds", miner.LockedFunds, fil("2100"))
+	assertBigInt(t, "QAP", miner.QAP, big.NewInt(22517998136852480))
+	assertBigInt(t, "RBP", miner.RBP, big.NewInt(2251799813685248))
+	assertBigInt(t, "LiveSectors", miner.LiveSectors, big.NewInt(2000))
+	assertBigInt(t, "ActiveSectors", miner.ActiveSectors, big.NewInt(1950))
+	assertBigInt(t, "FaultySectors", miner.FaultySectors, big.NewInt(50))
+	assertBigInt(t, "RecoveringSectors", miner.RecoveringSectors, big.NewInt(20))
+
+	if miners[0].AgentID != 1 || miners[1].AgentID != 1 {
+		t.Fatalf("expected the first two miners to belong to agent 1")
+	}
+}
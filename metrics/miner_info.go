@@ -3,48 +3,108 @@ package metrics
 import (
 	"context"
 	"math/big"
+	"sync"
 
 	"github.com/filecoin-project/go-address"
-	"github.com/glifio/go-pools/mstat"
-	psdk "github.com/glifio/go-pools/sdk"
-	pooltypes "github.com/glifio/go-pools/types"
+	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/glifio/go-pools/vc"
 )
 
-func MinerInfo(ctx context.Context, sdk pooltypes.PoolsSDK, miner address.Address) (*big.Int, *big.Int, *big.Int, *big.Int, error) {
-	lapi, closer, err := sdk.Extern().ConnectLotusClient()
+// a day's worth of a miner's vesting funds counts toward its expected daily rewards
+const minerVestingDays = 180
+
+// MinerInfoData is a miner's borrow cap and rate at a tipset
+type MinerInfoData struct {
+	MaxBorrow  *big.Int
+	AgentValue *big.Int
+	// lazy EDR plus a day of the miner's vesting funds
+	EDR *big.Int
+	// per-epoch WAD rate
+	Rate *big.Int
+	// intermediates of the computation, MaxBorrow is psdk.MaxBorrowFromAgentData(Inputs.AgentData, Rate)
+	Inputs *MinerInfoInputs
+
+	Height    *big.Int
+	TipSetKey types.TipSetKey
+	Timestamp uint64
+}
+
+// MinerInfoInputs are the values a miner's borrow cap and rate are derived from
+type MinerInfoInputs struct {
+	// expected daily rewards of the miner's current power
+	LazyEDR      *big.Int
+	VestingFunds *big.Int
+	VestingDays  int64
+	// VestingFunds / VestingDays, added to LazyEDR
+	VestingComponent *big.Int
+	// sent to vc.NullishVerifiableCredential to get the rate, and to psdk.MaxBorrowFromAgentData
+	AgentData *vc.AgentData
+}
+
+func MinerInfo(ctx context.Context, q PoolRateQuerier, lapi LotusAPI, stats MinerStatsAPI, miner address.Address) (*big.Int, *big.Int, *big.Int, *big.Int, error) {
+	info, err := MinerInfoAt(ctx, q, lapi, stats, miner, nil)
 	if err != nil {
 		return nil, nil, nil, nil, err
 	}
-	defer closer()
 
-	ts, err := sdk.Query().ChainHead(ctx)
+	return info.MaxBorrow, info.AgentValue, info.EDR, info.Rate, nil
+}
+
+// MinerInfoAt computes a miner's borrow cap and rate with every input evaluated at blockNumber
+func MinerInfoAt(ctx context.Context, q PoolRateQuerier, lapi LotusAPI, stats MinerStatsAPI, miner address.Address, blockNumber *big.Int) (*MinerInfoData, error) {
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, err
 	}
 
-	edr, err := mstat.ComputeEDRLazy1(ctx, miner, ts, lapi)
+	return minerInfoAtTipSet(ctx, q, lapi, stats, miner, ts)
+}
+
+// minerInfoAtTipSet computes a miner's borrow cap and rate at an already resolved tipset
+func minerInfoAtTipSet(ctx context.Context, q PoolRateQuerier, lapi LotusAPI, stats MinerStatsAPI, miner address.Address, ts *types.TipSet) (*MinerInfoData, error) {
+	inputs, err := minerInfoInputsAt(ctx, lapi, stats, miner, ts)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, err
 	}
+	agentData := inputs.AgentData
 
-	minerstat, err := mstat.ComputeMinerStats(ctx, miner, ts, lapi)
+	rate, err := q.InfPoolGetRateAt(ctx, agentData, tipSetBlockNumber(ts))
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, err
 	}
 
-	dayVest := new(big.Int).Div(minerstat.VestingFunds, big.NewInt(180))
-	edr = new(big.Int).Add(edr, dayVest)
+	return &MinerInfoData{
+		MaxBorrow:  q.MaxBorrowFromAgentData(agentData, rate),
+		AgentValue: agentData.AgentValue,
+		EDR:        agentData.ExpectedDailyRewards,
+		Rate:       rate,
+		Inputs:     inputs,
+		Height:     tipSetBlockNumber(ts),
+		TipSetKey:  ts.Key(),
+		Timestamp:  ts.MinTimestamp(),
+	}, nil
+}
 
-	agentValue, err := lapi.WalletBalance(ctx, miner)
+// minerInfoInputsAt evaluates a miner as an agent without principal, valued at its actor balance
+func minerInfoInputsAt(ctx context.Context, lapi LotusAPI, stats MinerStatsAPI, miner address.Address, ts *types.TipSet) (*MinerInfoInputs, error) {
+	lazyEDR, err := stats.ExpectedDailyRewards(ctx, miner, ts)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, err
 	}
 
-	agentVal, ok := new(big.Int).SetString(agentValue.String(), 10)
-	if !ok {
-		return nil, nil, nil, nil, err
+	vestingFunds, err := stats.VestingFunds(ctx, miner, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	dayVest := new(big.Int).Div(vestingFunds, big.NewInt(minerVestingDays))
+	edr := new(big.Int).Add(lazyEDR, dayVest)
+
+	actor, err := lapi.StateGetActor(ctx, miner, ts.Key())
+	if err != nil {
+		return nil, err
 	}
+	agentVal := new(big.Int).Set(actor.Balance.Int)
 
 	agentData := &vc.AgentData{
 		AgentValue:                  agentVal,
@@ -59,15 +119,49 @@ func MinerInfo(ctx context.Context, sdk pooltypes.PoolsSDK, miner address.Addres
 		GreenScore:                  big.NewInt(0),
 	}
 
-	nullishCred, err := vc.NullishVerifiableCredential(*agentData)
+	return &MinerInfoInputs{
+		LazyEDR:          lazyEDR,
+		VestingFunds:     vestingFunds,
+		VestingDays:      minerVestingDays,
+		VestingComponent: dayVest,
+		AgentData:        agentData,
+	}, nil
+}
+
+// MinerInfoResult is the miner info of a single miner in a batch, or the error computing it
+type MinerInfoResult struct {
+	Miner address.Address
+	Info  *MinerInfoData
+	Err   error
+}
+
+// BatchMinerInfo computes the miner info of every miner at the same tipset, running at most concurrency
+// computations at once. A failing miner reports its error without failing the rest of the batch.
+func BatchMinerInfo(ctx context.Context, q PoolRateQuerier, lapi LotusAPI, stats MinerStatsAPI, miners []address.Address, blockNumber *big.Int, concurrency int) ([]*MinerInfoResult, error) {
+	ts, err := ResolveTipSet(ctx, lapi, blockNumber)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, err
 	}
 
-	rate, err := sdk.Query().InfPoolGetRate(ctx, *nullishCred)
-	if err != nil {
-		return nil, nil, nil, nil, err
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]*MinerInfoResult, len(miners))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, miner := range miners {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, miner address.Address) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			info, err := minerInfoAtTipSet(ctx, q, lapi, stats, miner, ts)
+			results[i] = &MinerInfoResult{Miner: miner, Info: info, Err: err}
+		}(i, miner)
 	}
+	wg.Wait()
 
-	return psdk.MaxBorrowFromAgentData(agentData, rate), agentVal, edr, rate, nil
+	return results, nil
 }
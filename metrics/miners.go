@@ -5,12 +5,11 @@ import (
 	"math/big"
 
 	"github.com/filecoin-project/go-address"
-	pooltypes "github.com/glifio/go-pools/types"
 	"github.com/glifio/go-pools/util"
 )
 
-func Miners(ctx context.Context, sdk pooltypes.PoolsSDK, blockNumber *big.Int) (*big.Int, []address.Address, error) {
-	agentCount, err := sdk.Query().AgentFactoryAgentCount(ctx, blockNumber)
+func Miners(ctx context.Context, q PoolQuerier, blockNumber *big.Int) (*big.Int, []address.Address, error) {
+	agentCount, err := q.AgentFactoryAgentCount(ctx, blockNumber)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -21,7 +20,7 @@ func Miners(ctx context.Context, sdk pooltypes.PoolsSDK, blockNumber *big.Int) (
 		index := big.NewInt(i + 1)
 		tasks[i] = func() (interface{}, error) {
 			// add one to the index because the agent ids start at 1
-			return sdk.Query().MinerRegistryAgentMinersList(ctx, index, blockNumber)
+			return q.MinerRegistryAgentMinersList(ctx, index, blockNumber)
 		}
 	}
 
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	psdk "github.com/glifio/go-pools/sdk"
+	"github.com/glifio/go-pools/vc"
+)
+
+// rateModuleABI covers the two calls needed to price a credential: the pool's current
+// rate module, and the rate module's rate for a credential
+const rateModuleABI = `[
+	{"type":"function","name":"rateModule","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"getRate","stateMutability":"view","inputs":[{"name":"vc","type":"tuple","components":[
+		{"name":"issuer","type":"address"},
+		{"name":"subject","type":"uint256"},
+		{"name":"epochIssued","type":"uint256"},
+		{"name":"epochValidUntil","type":"uint256"},
+		{"name":"value","type":"uint256"},
+		{"name":"action","type":"bytes4"},
+		{"name":"target","type":"uint64"},
+		{"name":"claim","type":"bytes"}
+	]}],"outputs":[{"name":"","type":"uint256"}]}
+]`
+
+var parsedRateModuleABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(rateModuleABI))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// RateModule reads rates from the infinity pool's rate module through an eth client. Every call is made
+// at the requested block number, so both the rate module the pool pointed at and its state are historical.
+type RateModule struct {
+	caller bind.ContractCaller
+	pool   common.Address
+}
+
+// NewRateModule returns a RateModule calling the pool deployed at pool through caller
+func NewRateModule(caller bind.ContractCaller, pool common.Address) *RateModule {
+	return &RateModule{caller: caller, pool: pool}
+}
+
+// InfPoolGetRateAt prices the nullish credential of data, the credential the pool's rate module quotes
+// agents with before they borrow
+func (r *RateModule) InfPoolGetRateAt(ctx context.Context, data *vc.AgentData, blockNumber *big.Int) (*big.Int, error) {
+	cred, err := vc.NullishVerifiableCredential(*data)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: blockNumber}
+
+	var out []interface{}
+	pool := bind.NewBoundContract(r.pool, parsedRateModuleABI, r.caller, nil, nil)
+	if err := pool.Call(opts, &out, "rateModule"); err != nil {
+		return nil, fmt.Errorf("failed to read the pool's rate module at height %s: %w", blockNumber, err)
+	}
+	rateModule := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	out = nil
+	module := bind.NewBoundContract(rateModule, parsedRateModuleABI, r.caller, nil, nil)
+	if err := module.Call(opts, &out, "getRate", *cred); err != nil {
+		return nil, fmt.Errorf("failed to read the rate at height %s: %w", blockNumber, err)
+	}
+
+	return *abi.ConvertType(out[0], new(*big.Int)).(**big.Int), nil
+}
+
+func (r *RateModule) MaxBorrowFromAgentData(data *vc.AgentData, rate *big.Int) *big.Int {
+	return psdk.MaxBorrowFromAgentData(data, rate)
+}
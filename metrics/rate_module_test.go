@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/glifio/go-pools/vc"
+)
+
+// rateModuleChain answers the pool's rateModule and the rate module's getRate calls,
+// pricing every credential at the rate in effect at the called block
+type rateModuleChain struct {
+	pool       common.Address
+	rateModule common.Address
+	rateAt     func(blockNumber *big.Int) *big.Int
+	calls      []*big.Int
+	// calldata of getRate calls
+	getRates [][]byte
+}
+
+func newRateModuleChain(rateAt func(blockNumber *big.Int) *big.Int) *rateModuleChain {
+	return &rateModuleChain{
+		pool:       common.HexToAddress("0x43dAe5624445e7679D16a63211c5ff368681500c"),
+		rateModule: common.HexToAddress("0x9d8a2b1a5c8f0e7c6b5a4d3e2f1a0b9c8d7e6f50"),
+		rateAt:     rateAt,
+	}
+}
+
+func (c *rateModuleChain) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func (c *rateModuleChain) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.calls = append(c.calls, blockNumber)
+
+	method, err := parsedRateModuleABI.MethodById(call.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case method.Name == "rateModule" && *call.To == c.pool:
+		return method.Outputs.Pack(c.rateModule)
+	case method.Name == "getRate" && *call.To == c.rateModule:
+		c.getRates = append(c.getRates, call.Data)
+		return method.Outputs.Pack(c.rateAt(blockNumber))
+	}
+
+	return nil, ethereum.NotFound
+}
+
+// assertCredential checks the rate module was sent go-pools' nullish credential of data
+func (c *rateModuleChain) assertCredential(t *testing.T, data *vc.AgentData) {
+	t.Helper()
+
+	want, err := vc.NullishVerifiableCredential(*data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantData, err := parsedRateModuleABI.Pack("getRate", *want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.getRates) == 0 || !bytes.Equal(c.getRates[len(c.getRates)-1], wantData) {
+		t.Fatalf("expected the rate module to price %+v", *want)
+	}
+}
+
+func TestRateModule(t *testing.T) {
+	ctx := context.Background()
+
+	rates := map[int64]*big.Int{
+		3000000: big.NewInt(63419583967),
+		3299999: big.NewInt(95129375951),
+	}
+	chain := newRateModuleChain(func(blockNumber *big.Int) *big.Int { return rates[blockNumber.Int64()] })
+	module := NewRateModule(chain, chain.pool)
+
+	data := &vc.AgentData{
+		AgentValue:                  fil("1000"),
+		CollateralValue:             big.NewInt(0),
+		ExpectedDailyFaultPenalties: big.NewInt(0),
+		ExpectedDailyRewards:        fil("3"),
+		Gcred:                       big.NewInt(100),
+		QaPower:                     big.NewInt(0),
+		Principal:                   big.NewInt(0),
+		FaultySectors:               big.NewInt(0),
+		LiveSectors:                 big.NewInt(0),
+		GreenScore:                  big.NewInt(0),
+	}
+	for height, want := range rates {
+		chain.calls = nil
+		rate, err := module.InfPoolGetRateAt(ctx, data, big.NewInt(height))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertBigInt(t, "Rate", rate, want)
+		chain.assertCredential(t, data)
+
+		// both the rate module lookup and the rate itself are read at the requested height
+		if len(chain.calls) != 2 || chain.calls[0].Int64() != height || chain.calls[1].Int64() != height {
+			t.Fatalf("expected 2 calls at height %d, got %v", height, chain.calls)
+		}
+	}
+}
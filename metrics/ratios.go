@@ -0,0 +1,25 @@
+package metrics
+
+import "math/big"
+
+// SetRatios derives the pool's utilization and liquidity ratios from its balances,
+// leaving them unset when a balance is missing
+func (d *MetricData) SetRatios() {
+	if d.PoolTotalAssets == nil || d.PoolTotalBorrowed == nil || d.PoolTotalBorrowableAssets == nil || d.PoolExitReserve == nil {
+		return
+	}
+
+	d.Utilization = ratio(d.PoolTotalBorrowed, d.PoolTotalAssets)
+	d.BorrowableShare = ratio(d.PoolTotalBorrowableAssets, d.PoolTotalAssets)
+	d.ExitReserveCoverage = ratio(d.PoolExitReserve, d.PoolTotalAssets)
+	// the pool's liquid FIL is what can be borrowed plus what is held back for exits
+	d.WithdrawableLiquidity = new(big.Int).Add(d.PoolTotalBorrowableAssets, d.PoolExitReserve)
+}
+
+// ratio returns num/denom, or zero when denom is zero
+func ratio(num *big.Int, denom *big.Int) *big.Rat {
+	if denom.Sign() == 0 {
+		return new(big.Rat)
+	}
+	return new(big.Rat).SetFrac(num, denom)
+}
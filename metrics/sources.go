@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/go-pools/mstat"
+	pooltypes "github.com/glifio/go-pools/types"
+	"github.com/glifio/go-pools/vc"
+)
+
+// the SDK's query API and the Lotus client must keep satisfying the interfaces the metrics package reads through
+var (
+	_ PoolQuerier = (pooltypes.PoolsQuery)(nil)
+	_ LotusAPI    = (*api.FullNodeStruct)(nil)
+)
+
+// PoolQuerier is the subset of the PoolsSDK query API read by the metrics package.
+// sdk.Query() satisfies it, tests and other callers can provide their own implementation.
+type PoolQuerier interface {
+	ChainHead(ctx context.Context) (*types.TipSet, error)
+	AgentFactoryAgentCount(ctx context.Context, blockNumber *big.Int) (*big.Int, error)
+	AgentLiquidAssets(ctx context.Context, agentAddr common.Address, blockNumber *big.Int) (*big.Int, error)
+	AgentPrincipal(ctx context.Context, agentAddr common.Address, blockNumber *big.Int) (*big.Int, error)
+	MinerRegistryAgentMinersList(ctx context.Context, agentID *big.Int, blockNumber *big.Int) ([]address.Address, error)
+	InfPoolApy(ctx context.Context, blockNumber *big.Int) (*big.Int, error)
+	InfPoolBorrowableLiquidity(ctx context.Context, blockNumber *big.Int) (*big.Float, error)
+	InfPoolExitReserve(ctx context.Context, blockNumber *big.Int) (*big.Int, *big.Int, error)
+	InfPoolTotalAssets(ctx context.Context, blockNumber *big.Int) (*big.Float, error)
+	InfPoolTotalBorrowed(ctx context.Context, blockNumber *big.Int) (*big.Float, error)
+	IFILTotalSupply(ctx context.Context, blockNumber *big.Int) (*big.Float, error)
+}
+
+// RateQuerier prices agent data with the pool's rate module as deployed at blockNumber, and caps what the
+// agent can borrow at a rate. RateModule implements it against the chain with go-pools' credential and
+// max borrow formula.
+type RateQuerier interface {
+	InfPoolGetRateAt(ctx context.Context, data *vc.AgentData, blockNumber *big.Int) (*big.Int, error)
+	// MaxBorrowFromAgentData returns the FIL the agent can borrow on top of the principal data carries
+	MaxBorrowFromAgentData(data *vc.AgentData, rate *big.Int) *big.Int
+}
+
+// PoolRateQuerier is a PoolQuerier that also prices and caps borrowing, see NewPoolRateQuerier
+type PoolRateQuerier interface {
+	PoolQuerier
+	RateQuerier
+}
+
+type poolRateQuerier struct {
+	PoolQuerier
+	RateQuerier
+}
+
+// NewPoolRateQuerier combines the SDK's query API with a rate querier
+func NewPoolRateQuerier(q PoolQuerier, rates RateQuerier) PoolRateQuerier {
+	return &poolRateQuerier{PoolQuerier: q, RateQuerier: rates}
+}
+
+// LotusAPI is the subset of the Lotus full node API read by the metrics package.
+// *api.FullNodeStruct satisfies it.
+type LotusAPI interface {
+	ChainHead(ctx context.Context) (*types.TipSet, error)
+	ChainGetTipSetByHeight(ctx context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error)
+	StateGetActor(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*types.Actor, error)
+	StateMinerAvailableBalance(ctx context.Context, addr address.Address, tsk types.TipSetKey) (types.BigInt, error)
+	StateMinerFaults(ctx context.Context, addr address.Address, tsk types.TipSetKey) (bitfield.BitField, error)
+	StateMinerInfo(ctx context.Context, addr address.Address, tsk types.TipSetKey) (api.MinerInfo, error)
+	StateMinerPower(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*api.MinerPower, error)
+	StateMinerRecoveries(ctx context.Context, addr address.Address, tsk types.TipSetKey) (bitfield.BitField, error)
+	StateMinerSectorCount(ctx context.Context, addr address.Address, tsk types.TipSetKey) (api.MinerSectors, error)
+	StateMinerSectors(ctx context.Context, addr address.Address, filter *bitfield.BitField, tsk types.TipSetKey) ([]*miner.SectorOnChainInfo, error)
+	StateReadState(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*api.ActorState, error)
+}
+
+// MinerStatsAPI computes the per miner statistics that feed into a miner's borrow cap
+type MinerStatsAPI interface {
+	// ExpectedDailyRewards returns the lazily computed expected daily rewards of the miner
+	ExpectedDailyRewards(ctx context.Context, miner address.Address, ts *types.TipSet) (*big.Int, error)
+	// VestingFunds returns the miner's funds that are still vesting
+	VestingFunds(ctx context.Context, miner address.Address, ts *types.TipSet) (*big.Int, error)
+}
+
+// NewMinerStats returns a MinerStatsAPI that computes miner statistics through go-pools' mstat package
+func NewMinerStats(lapi *api.FullNodeStruct) MinerStatsAPI {
+	return &mstatMinerStats{lapi: lapi}
+}
+
+type mstatMinerStats struct {
+	lapi *api.FullNodeStruct
+}
+
+func (s *mstatMinerStats) ExpectedDailyRewards(ctx context.Context, miner address.Address, ts *types.TipSet) (*big.Int, error) {
+	return mstat.ComputeEDRLazy1(ctx, miner, ts, s.lapi)
+}
+
+func (s *mstatMinerStats) VestingFunds(ctx context.Context, miner address.Address, ts *types.TipSet) (*big.Int, error) {
+	minerstat, err := mstat.ComputeMinerStats(ctx, miner, ts, s.lapi)
+	if err != nil {
+		return nil, err
+	}
+
+	return minerstat.VestingFunds, nil
+}
+
+// Agent is an agent deployed by the agent factory
+type Agent struct {
+	TxHash  string         `json:"txHash"`
+	ID      uint64         `json:"id"`
+	Address common.Address `json:"address"`
+	Height  *big.Int       `json:"height"`
+}
+
+// AgentLister lists every agent deployed by the agent factory
+type AgentLister interface {
+	ListAgents(ctx context.Context) ([]Agent, error)
+}
+
+// DefaultAgentsURL is the glif events service endpoint that lists every agent
+const DefaultAgentsURL = "https://events.glif.link/agent/list"
+
+// EventsAgentLister lists agents from a glif events service
+type EventsAgentLister struct {
+	URL string
+}
+
+func (l *EventsAgentLister) ListAgents(ctx context.Context) ([]Agent, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list agents: %s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var agents []Agent
+	err = json.Unmarshal(body, &agents)
+	if err != nil {
+		return nil, err
+	}
+
+	return agents, nil
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// ResolveTipSet returns the tipset at blockNumber, or the latest tipset when blockNumber is nil.
+// If blockNumber is a null round, the closest tipset before it is returned.
+//
+// The latest tipset is the parent of the chain head, matching what Lotus' eth API serves as "latest",
+// since the head's state has not been executed yet. Contract calls and Lotus calls pinned to the
+// returned tipset's height therefore always read the same state.
+func ResolveTipSet(ctx context.Context, lapi LotusAPI, blockNumber *big.Int) (*types.TipSet, error) {
+	if blockNumber != nil {
+		return lapi.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(blockNumber.Int64()), types.EmptyTSK)
+	}
+
+	head, err := lapi.ChainHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return lapi.ChainGetTipSetByHeight(ctx, head.Height()-1, head.Key())
+}
+
+// tipSetBlockNumber returns the height of ts as the block number used by contract calls
+func tipSetBlockNumber(ts *types.TipSet) *big.Int {
+	return big.NewInt(int64(ts.Height()))
+}
@@ -0,0 +1,127 @@
+// Package prom exposes pool metrics as Prometheus gauges
+package prom
+
+import (
+	"math/big"
+
+	"github.com/glifio/go-pools/util"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "glif_pools"
+
+var chainIDLabel = []string{"chain_id"}
+
+func newDesc(name string, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, chainIDLabel, nil)
+}
+
+var (
+	poolTotalAssetsDesc     = newDesc("pool_total_assets_fil", "Total assets of the infinity pool in FIL")
+	poolTotalBorrowedDesc   = newDesc("pool_total_borrowed_fil", "Total FIL borrowed from the infinity pool")
+	poolBorrowableDesc      = newDesc("pool_borrowable_assets_fil", "FIL available to borrow from the infinity pool")
+	poolExitReserveDesc     = newDesc("pool_exit_reserve_fil", "FIL held in the infinity pool's exit reserve")
+	poolUtilizationDesc     = newDesc("pool_utilization_ratio", "Share of the infinity pool's assets that is borrowed")
+	poolBorrowableShareDesc = newDesc("pool_borrowable_ratio", "Share of the infinity pool's assets that can be borrowed")
+	poolExitCoverageDesc    = newDesc("pool_exit_reserve_ratio", "Share of the infinity pool's assets held in the exit reserve")
+	poolWithdrawableDesc    = newDesc("pool_withdrawable_fil", "FIL available for withdrawal from the infinity pool")
+	poolApyDesc             = newDesc("pool_apy_ratio", "Projected APY of the infinity pool, 0.1 is 10%")
+	agentCountDesc          = newDesc("agents", "Number of agents")
+	minerCountDesc          = newDesc("miners", "Number of miners pledged to agents")
+	minerCollateralsDesc    = newDesc("miner_collaterals_fil", "Total collaterals of pledged miners in FIL")
+	minerSectorsDesc        = newDesc("miner_sectors", "Total live sectors of pledged miners")
+	minerSectorsStateDesc   = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "miner_sectors_by_state"),
+		"Total sectors of pledged miners by state", []string{"chain_id", "state"}, nil)
+	minerQAPDesc          = newDesc("miner_qap_bytes", "Total quality adjusted power of pledged miners")
+	minerRBPDesc          = newDesc("miner_rbp_bytes", "Total raw byte power of pledged miners")
+	networkQAPDesc        = newDesc("network_qap_bytes", "Total quality adjusted power of the network")
+	networkRBPDesc        = newDesc("network_rbp_bytes", "Total raw byte power of the network")
+	qapShareDesc          = newDesc("miner_qap_share_ratio", "Share of the network's quality adjusted power held by pledged miners")
+	rbpShareDesc          = newDesc("miner_rbp_share_ratio", "Share of the network's raw byte power held by pledged miners")
+	blockRewardShareDesc  = newDesc("miner_block_reward_share_ratio", "Expected share of block rewards won by pledged miners")
+	totalValueLockedDesc  = newDesc("total_value_locked_fil", "Total value locked in FIL")
+	heightDesc            = newDesc("height", "Height of the tipset the metrics were computed at")
+	snapshotTimestampDesc = newDesc("timestamp_seconds", "Timestamp of the tipset the metrics were computed at")
+)
+
+// Collector reports a single metrics snapshot as Prometheus gauges
+type Collector struct {
+	chainID string
+	metrics *m.MetricData
+	apy     *big.Float
+}
+
+// NewCollector returns a collector reporting metrics and apy, labeled by chainID
+func NewCollector(chainID *big.Int, metrics *m.MetricData, apy *big.Float) *Collector {
+	return &Collector{
+		chainID: chainID.String(),
+		metrics: metrics,
+		apy:     apy,
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	gauge := func(desc *prometheus.Desc, val float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, val, c.chainID)
+	}
+
+	gauge(poolTotalAssetsDesc, filValue(c.metrics.PoolTotalAssets))
+	gauge(poolTotalBorrowedDesc, filValue(c.metrics.PoolTotalBorrowed))
+	gauge(poolBorrowableDesc, filValue(c.metrics.PoolTotalBorrowableAssets))
+	gauge(poolExitReserveDesc, filValue(c.metrics.PoolExitReserve))
+	if c.metrics.Utilization != nil {
+		gauge(poolUtilizationDesc, ratioValue(c.metrics.Utilization))
+		gauge(poolBorrowableShareDesc, ratioValue(c.metrics.BorrowableShare))
+		gauge(poolExitCoverageDesc, ratioValue(c.metrics.ExitReserveCoverage))
+		gauge(poolWithdrawableDesc, filValue(c.metrics.WithdrawableLiquidity))
+	}
+	gauge(agentCountDesc, intValue(c.metrics.TotalAgentCount))
+	gauge(minerCountDesc, intValue(c.metrics.TotalMinersCount))
+	gauge(minerCollateralsDesc, filValue(c.metrics.TotalMinerCollaterals))
+	gauge(minerSectorsDesc, intValue(c.metrics.TotalMinersSectors))
+	for state, count := range map[string]*big.Int{
+		"live":       c.metrics.TotalMinersSectors,
+		"active":     c.metrics.TotalActiveSectors,
+		"faulty":     c.metrics.TotalFaultySectors,
+		"recovering": c.metrics.TotalRecoveringSectors,
+	} {
+		ch <- prometheus.MustNewConstMetric(minerSectorsStateDesc, prometheus.GaugeValue, intValue(count), c.chainID, state)
+	}
+	gauge(minerQAPDesc, intValue(c.metrics.TotalMinerQAP))
+	gauge(minerRBPDesc, intValue(c.metrics.TotalMinerRBP))
+	if c.metrics.NetworkQAP != nil {
+		gauge(networkQAPDesc, intValue(c.metrics.NetworkQAP))
+		gauge(networkRBPDesc, intValue(c.metrics.NetworkRBP))
+		gauge(qapShareDesc, ratioValue(c.metrics.QAPShare))
+		gauge(rbpShareDesc, ratioValue(c.metrics.RBPShare))
+		gauge(blockRewardShareDesc, ratioValue(c.metrics.BlockRewardShare))
+	}
+	gauge(totalValueLockedDesc, filValue(c.metrics.TotalValueLocked))
+	gauge(heightDesc, intValue(c.metrics.Height))
+	gauge(snapshotTimestampDesc, float64(c.metrics.Timestamp))
+
+	if c.apy != nil {
+		apy, _ := c.apy.Float64()
+		gauge(poolApyDesc, apy)
+	}
+}
+
+func filValue(atto *big.Int) float64 {
+	fil, _ := util.ToFIL(atto).Float64()
+	return fil
+}
+
+func ratioValue(val *big.Rat) float64 {
+	f, _ := val.Float64()
+	return f
+}
+
+func intValue(val *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(val).Float64()
+	return f
+}
@@ -0,0 +1,80 @@
+package prom
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/go-pools/constants"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	metrics := &m.MetricData{
+		PoolTotalAssets:           types.MustParseFIL("2000000").Int,
+		PoolTotalBorrowed:         types.MustParseFIL("3000").Int,
+		PoolTotalBorrowableAssets: types.MustParseFIL("1000000").Int,
+		PoolExitReserve:           types.MustParseFIL("100000").Int,
+		TotalAgentCount:           big.NewInt(3),
+		TotalMinerCollaterals:     types.MustParseFIL("1015").Int,
+		TotalMinersCount:          big.NewInt(3),
+		TotalValueLocked:          types.MustParseFIL("2001015").Int,
+		TotalMinersSectors:        big.NewInt(42),
+		TotalActiveSectors:        big.NewInt(40),
+		TotalFaultySectors:        big.NewInt(2),
+		TotalRecoveringSectors:    big.NewInt(1),
+		TotalMinerQAP:             big.NewInt(39406496739491840),
+		TotalMinerRBP:             big.NewInt(9007199254740992),
+		NetworkQAP:                big.NewInt(3940649673949184000),
+		NetworkRBP:                big.NewInt(900719925474099200),
+		QAPShare:                  big.NewRat(1, 100),
+		RBPShare:                  big.NewRat(1, 100),
+		BlockRewardShare:          big.NewRat(1, 100),
+		Height:                    big.NewInt(3299999),
+		Timestamp:                 1697306370,
+	}
+	metrics.SetRatios()
+
+	c := NewCollector(big.NewInt(constants.MainnetChainID), metrics, big.NewFloat(0.125))
+
+	expected := `
+# HELP glif_pools_pool_total_borrowed_fil Total FIL borrowed from the infinity pool
+# TYPE glif_pools_pool_total_borrowed_fil gauge
+glif_pools_pool_total_borrowed_fil{chain_id="314"} 3000
+# HELP glif_pools_miner_sectors Total live sectors of pledged miners
+# TYPE glif_pools_miner_sectors gauge
+glif_pools_miner_sectors{chain_id="314"} 42
+# HELP glif_pools_miner_sectors_by_state Total sectors of pledged miners by state
+# TYPE glif_pools_miner_sectors_by_state gauge
+glif_pools_miner_sectors_by_state{chain_id="314",state="active"} 40
+glif_pools_miner_sectors_by_state{chain_id="314",state="faulty"} 2
+glif_pools_miner_sectors_by_state{chain_id="314",state="live"} 42
+glif_pools_miner_sectors_by_state{chain_id="314",state="recovering"} 1
+# HELP glif_pools_pool_utilization_ratio Share of the infinity pool's assets that is borrowed
+# TYPE glif_pools_pool_utilization_ratio gauge
+glif_pools_pool_utilization_ratio{chain_id="314"} 0.0015
+# HELP glif_pools_miner_qap_share_ratio Share of the network's quality adjusted power held by pledged miners
+# TYPE glif_pools_miner_qap_share_ratio gauge
+glif_pools_miner_qap_share_ratio{chain_id="314"} 0.01
+# HELP glif_pools_pool_apy_ratio Projected APY of the infinity pool, 0.1 is 10%
+# TYPE glif_pools_pool_apy_ratio gauge
+glif_pools_pool_apy_ratio{chain_id="314"} 0.125
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"glif_pools_pool_total_borrowed_fil",
+		"glif_pools_miner_sectors",
+		"glif_pools_miner_sectors_by_state",
+		"glif_pools_pool_utilization_ratio",
+		"glif_pools_miner_qap_share_ratio",
+		"glif_pools_pool_apy_ratio",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.CollectAndCount(c); n != 27 {
+		t.Fatalf("expected 27 gauges, got %d", n)
+	}
+}
@@ -0,0 +1,122 @@
+// Package shared wires the handlers and commands to the chain: the pools SDK, Lotus and eth connections,
+// and the agent list service. Connections registered with Set are reused across requests.
+package shared
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+
+	"github.com/filecoin-project/lotus/api"
+	lotustypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/go-pools/constants"
+	psdk "github.com/glifio/go-pools/sdk"
+	pooltypes "github.com/glifio/go-pools/types"
+	"github.com/glifio/pools-metrics/common"
+	m "github.com/glifio/pools-metrics/metrics"
+)
+
+// shared holds a process-wide SDK and Lotus connection for a single chain
+type shared struct {
+	sdk  pooltypes.PoolsSDK
+	lapi *api.FullNodeStruct
+}
+
+var (
+	sharedMu sync.RWMutex
+	sharedBy = make(map[int64]*shared)
+)
+
+// Set registers an SDK and Lotus connection that every request for chainID reuses,
+// instead of dialing new connections per request. Long running servers call this once at startup.
+func Set(chainID *big.Int, sdk pooltypes.PoolsSDK, lapi *api.FullNodeStruct) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	sharedBy[chainID.Int64()] = &shared{sdk: sdk, lapi: lapi}
+}
+
+func getShared(chainID *big.Int) (*shared, bool) {
+	sharedMu.RLock()
+	defer sharedMu.RUnlock()
+	s, ok := sharedBy[chainID.Int64()]
+	return s, ok
+}
+
+func NewSDK(r *http.Request) (pooltypes.PoolsSDK, error) {
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := getShared(chainID); ok {
+		return s.sdk, nil
+	}
+
+	extern, err := common.GetExtern(chainID)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context()
+
+	sdk, err := psdk.New(ctx, chainID, extern)
+	return sdk, nil
+}
+
+// ConnectLotusClient returns the shared Lotus connection for the request's chain if one is registered,
+// otherwise it dials a new connection through the SDK. The returned closer must always be called.
+func ConnectLotusClient(r *http.Request, sdk pooltypes.PoolsSDK) (*api.FullNodeStruct, func(), error) {
+	chainID, err := common.GetChainID(r.URL.Query())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s, ok := getShared(chainID); ok && s.lapi != nil {
+		return s.lapi, func() {}, nil
+	}
+
+	lapi, closer, err := sdk.Extern().ConnectLotusClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return lapi, closer, nil
+}
+
+// ConnectPoolRates returns the SDK's query API along with a rate module read through the SDK's eth client,
+// so credentials can be priced at any height. The returned closer must always be called.
+func ConnectPoolRates(sdk pooltypes.PoolsSDK) (m.PoolRateQuerier, func(), error) {
+	client, err := sdk.Extern().ConnectEthClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q := sdk.Query()
+	return m.NewPoolRateQuerier(q, m.NewRateModule(client, q.InfinityPool())), client.Close, nil
+}
+
+// GetAgentLister returns the service listing the agents deployed on chainID
+func GetAgentLister(chainID *big.Int) (m.AgentLister, error) {
+	switch chainID.Int64() {
+	case constants.MainnetChainID:
+		return &m.EventsAgentLister{URL: m.DefaultAgentsURL}, nil
+	default:
+		return nil, errors.New("Unsupported chainID - add an agent list service")
+	}
+}
+
+// ResolveTipSets returns the current chain head, and the tipset a request for blockNumber reads from
+func ResolveTipSets(ctx context.Context, lapi m.LotusAPI, blockNumber *big.Int) (head *lotustypes.TipSet, ts *lotustypes.TipSet, err error) {
+	head, err = lapi.ChainHead(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ts, err = m.ResolveTipSet(ctx, lapi, blockNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return head, ts, nil
+}
@@ -0,0 +1,130 @@
+// Package store persists computed metric snapshots in an embedded LevelDB database,
+// keyed by chain ID and height.
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ErrNotFound is returned when no snapshot is stored at a height
+var ErrNotFound = errors.New("snapshot not found")
+
+// Store is a history of MetricData snapshots. It is safe for concurrent use.
+type Store struct {
+	db *leveldb.DB
+}
+
+// Open opens the store at path, creating it if it does not exist
+func Open(path string) (*Store, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// snapshots are keyed by "metrics/<chainID>/<height>" with the height big endian encoded,
+// so iterating a chain's keys walks its snapshots in height order
+func metricsPrefix(chainID *big.Int) []byte {
+	return []byte(fmt.Sprintf("metrics/%s/", chainID))
+}
+
+func metricsKey(chainID *big.Int, height int64) []byte {
+	key := metricsPrefix(chainID)
+	return binary.BigEndian.AppendUint64(key, uint64(height))
+}
+
+// Put stores a snapshot under its chain ID and height, replacing any snapshot already stored there
+func (s *Store) Put(chainID *big.Int, metrics *m.MetricData) error {
+	if metrics.Height == nil {
+		return errors.New("snapshot has no height")
+	}
+
+	val, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Put(metricsKey(chainID, metrics.Height.Int64()), val, &opt.WriteOptions{Sync: true})
+}
+
+// Get returns the snapshot stored at height, or ErrNotFound
+func (s *Store) Get(chainID *big.Int, height int64) (*m.MetricData, error) {
+	val, err := s.db.Get(metricsKey(chainID, height), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics m.MetricData
+	if err := json.Unmarshal(val, &metrics); err != nil {
+		return nil, err
+	}
+
+	return &metrics, nil
+}
+
+// Has reports whether a snapshot is stored at height
+func (s *Store) Has(chainID *big.Int, height int64) (bool, error) {
+	return s.db.Has(metricsKey(chainID, height), nil)
+}
+
+// Range returns every snapshot stored between from and to inclusive, in height order
+func (s *Store) Range(chainID *big.Int, from int64, to int64) ([]*m.MetricData, error) {
+	iter := s.db.NewIterator(&util.Range{
+		Start: metricsKey(chainID, from),
+		Limit: metricsKey(chainID, to+1),
+	}, nil)
+	defer iter.Release()
+
+	var snapshots []*m.MetricData
+	for iter.Next() {
+		var metrics m.MetricData
+		if err := json.Unmarshal(iter.Value(), &metrics); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, &metrics)
+	}
+
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+var (
+	defaultMu sync.RWMutex
+	defaultSt *Store
+)
+
+// SetDefault makes s the store the HTTP handlers read history from
+func SetDefault(s *Store) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultSt = s
+}
+
+// Default returns the store set by SetDefault, or nil if there is none
+func Default() *Store {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultSt
+}
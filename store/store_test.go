@@ -0,0 +1,65 @@
+package store
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/glifio/go-pools/constants"
+	m "github.com/glifio/pools-metrics/metrics"
+)
+
+func snapshot(height int64) *m.MetricData {
+	return &m.MetricData{
+		PoolTotalAssets: big.NewInt(height * 10),
+		Height:          big.NewInt(height),
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	mainnet := big.NewInt(constants.MainnetChainID)
+	calibnet := big.NewInt(constants.CalibnetChainID)
+
+	for _, height := range []int64{300, 100, 200} {
+		if err := s.Put(mainnet, snapshot(height)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put(calibnet, snapshot(150)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get(mainnet, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PoolTotalAssets.Int64() != 2000 {
+		t.Fatalf("PoolTotalAssets: got %v, want 2000", got.PoolTotalAssets)
+	}
+
+	if _, err := s.Get(mainnet, 150); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	has, err := s.Has(calibnet, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Fatal("calibnet snapshot should be stored")
+	}
+
+	snapshots, err := s.Range(mainnet, 100, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Height.Int64() != 100 || snapshots[1].Height.Int64() != 200 {
+		t.Fatalf("Range should return the snapshots at 100 and 200 in order, got %d snapshots", len(snapshots))
+	}
+}
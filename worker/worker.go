@@ -0,0 +1,165 @@
+// Package worker precomputes metrics for every new tipset in the background,
+// so the HTTP handlers can serve the latest snapshot without computing it per request.
+package worker
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/pools-metrics/cache"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/store"
+)
+
+// Worker watches the chain head and recomputes the pool metrics for each new tipset
+type Worker struct {
+	chainID      *big.Int
+	q            m.PoolQuerier
+	lapi         m.LotusAPI
+	agents       m.AgentLister
+	pollInterval time.Duration
+	store        *store.Store
+
+	mu     sync.RWMutex
+	latest *m.MetricData
+	// snapshots waiting to be persisted once they are final, in height order
+	pending []*m.MetricData
+}
+
+func New(chainID *big.Int, q m.PoolQuerier, lapi m.LotusAPI, agents m.AgentLister, pollInterval time.Duration) *Worker {
+	return &Worker{
+		chainID:      chainID,
+		q:            q,
+		lapi:         lapi,
+		agents:       agents,
+		pollInterval: pollInterval,
+	}
+}
+
+// PersistTo makes the worker save every snapshot it computes to s, once its tipset is final.
+// Snapshots still pending when the worker stops are left for the backfill command.
+func (w *Worker) PersistTo(s *store.Store) {
+	w.store = s
+}
+
+// Run polls the chain head until ctx is done, recomputing the metrics whenever the latest tipset changes.
+// If computing takes longer than an epoch, intermediate tipsets are skipped in favor of the newest one.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.update(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error precomputing metrics: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Latest returns the most recently completed snapshot, or nil if none has completed yet
+func (w *Worker) Latest() *m.MetricData {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.latest
+}
+
+func (w *Worker) update(ctx context.Context) error {
+	head, err := w.lapi.ChainHead(ctx)
+	if err != nil {
+		return err
+	}
+
+	ts, err := m.ResolveTipSet(ctx, w.lapi, nil)
+	if err != nil {
+		return err
+	}
+
+	if latest := w.Latest(); latest != nil && latest.Height.Int64() == int64(ts.Height()) {
+		return nil
+	}
+
+	metrics, err := m.Metrics(ctx, w.q, w.lapi, w.agents, big.NewInt(int64(ts.Height())))
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.latest = metrics
+	w.mu.Unlock()
+
+	if w.store != nil {
+		w.pending = append(w.pending, metrics)
+		if err := w.persistFinal(ctx, head); err != nil {
+			return err
+		}
+	}
+
+	// share the snapshot with requests for this height
+	key := cache.Key{ChainID: w.chainID.Int64(), Height: metrics.Height.Int64(), Endpoint: "metrics"}
+	cache.Default.Add(key, metrics, int64(head.Height()))
+
+	return nil
+}
+
+// persistFinal saves the pending snapshots that are at least cache.Finality epochs behind head.
+// A snapshot whose tipset was reorged out is recomputed at the tipset that replaced it.
+func (w *Worker) persistFinal(ctx context.Context, head *types.TipSet) error {
+	final := int64(head.Height()) - cache.Finality
+
+	for len(w.pending) > 0 && w.pending[0].Height.Int64() <= final {
+		metrics := w.pending[0]
+
+		ts, err := w.lapi.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(metrics.Height.Int64()), head.Key())
+		if err != nil {
+			return err
+		}
+		if ts.Key() != metrics.TipSetKey {
+			metrics, err = m.Metrics(ctx, w.q, w.lapi, w.agents, big.NewInt(int64(ts.Height())))
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := w.store.Put(w.chainID, metrics); err != nil {
+			return err
+		}
+		w.pending = w.pending[1:]
+	}
+
+	return nil
+}
+
+var (
+	workersMu sync.RWMutex
+	workers   = make(map[int64]*Worker)
+)
+
+// Register makes w the worker serving snapshots for its chain
+func Register(w *Worker) {
+	workersMu.Lock()
+	defer workersMu.Unlock()
+	workers[w.chainID.Int64()] = w
+}
+
+// Latest returns the latest snapshot computed by the worker registered for chainID, if any
+func Latest(chainID *big.Int) (*m.MetricData, bool) {
+	workersMu.RLock()
+	w, ok := workers[chainID.Int64()]
+	workersMu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	latest := w.Latest()
+	return latest, latest != nil
+}
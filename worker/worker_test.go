@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/glifio/go-pools/constants"
+	"github.com/glifio/pools-metrics/cache"
+	m "github.com/glifio/pools-metrics/metrics"
+	"github.com/glifio/pools-metrics/metrics/metricstest"
+	"github.com/glifio/pools-metrics/store"
+)
+
+func TestWorkerUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	fixture, err := metricstest.LoadFixture("../metrics/testdata/fixture.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lotus := metricstest.NewLotus(fixture)
+	defer lotus.Close()
+
+	lapi, closer, err := lotus.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer()
+
+	events := metricstest.NewAgentsServer(fixture)
+	defer events.Close()
+
+	chainID := big.NewInt(constants.MainnetChainID)
+	w := New(chainID, metricstest.NewPool(fixture), lapi, &m.EventsAgentLister{URL: events.URL + "/agent/list"}, time.Second)
+	Register(w)
+
+	if _, ok := Latest(chainID); ok {
+		t.Fatal("there should be no snapshot before the first update")
+	}
+
+	if err := w.update(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, ok := Latest(chainID)
+	if !ok {
+		t.Fatal("expected a snapshot after the first update")
+	}
+	if latest.Height.Int64() != fixture.Head-1 {
+		t.Fatalf("snapshot height: got %v, want %d", latest.Height, fixture.Head-1)
+	}
+
+	// the head has not moved, so the snapshot is kept as is
+	if err := w.update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := Latest(chainID); again != latest {
+		t.Fatal("snapshot should not be recomputed for the same tipset")
+	}
+}
+
+func TestWorkerPersistsFinalSnapshots(t *testing.T) {
+	ctx := context.Background()
+
+	fixture, err := metricstest.LoadFixture("../metrics/testdata/fixture.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lotus := metricstest.NewLotus(fixture)
+	defer lotus.Close()
+
+	lapi, closer, err := lotus.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer()
+
+	events := metricstest.NewAgentsServer(fixture)
+	defer events.Close()
+
+	st, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	chainID := big.NewInt(constants.CalibnetChainID)
+	w := New(chainID, metricstest.NewPool(fixture), lapi, &m.EventsAgentLister{URL: events.URL + "/agent/list"}, time.Second)
+	w.PersistTo(st)
+
+	if err := w.update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first := w.Latest().Height.Int64()
+
+	// the snapshot is not final yet, so it is only kept in memory
+	if stored, err := st.Has(chainID, first); err != nil || stored {
+		t.Fatalf("snapshot at %d should not be stored before it is final (err %v)", first, err)
+	}
+
+	// pretend the first snapshot was computed on a tipset that was later reorged out
+	w.pending[0].TipSetKey = types.EmptyTSK
+
+	fixture.Head += cache.Finality
+	if err := w.update(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := st.Get(chainID, first)
+	if err != nil {
+		t.Fatalf("snapshot at %d should be stored once final: %v", first, err)
+	}
+	canonical, err := fixture.TipSet(abi.ChainEpoch(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TipSetKey != canonical.Key() {
+		t.Fatalf("stored snapshot tipset %s, want the canonical %s", got.TipSetKey, canonical.Key())
+	}
+
+	if stored, err := st.Has(chainID, w.Latest().Height.Int64()); err != nil || stored {
+		t.Fatalf("the latest snapshot should not be stored yet (err %v)", err)
+	}
+	if len(w.pending) != 1 {
+		t.Fatalf("expected the latest snapshot to be pending, got %d pending", len(w.pending))
+	}
+}